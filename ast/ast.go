@@ -10,6 +10,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -34,6 +35,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -56,6 +64,10 @@ func (ls *LetStatement) TokenLiteral() string {
 	return string(ls.Token.Literal)
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -83,6 +95,10 @@ func (i *Identifier) TokenLiteral() string {
 	return string(i.Token.Literal)
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -98,6 +114,10 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return string(rs.Token.Literal)
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -123,6 +143,10 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return string(es.Token.Literal)
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -142,10 +166,33 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return string(il.Token.Literal)
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
 func (il *IntegerLiteral) String() string {
 	return string(il.Token.Literal)
 }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) ExpressionNode() {}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return string(fl.Token.Literal)
+}
+
+func (fl *FloatLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) String() string {
+	return string(fl.Token.Literal)
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -158,6 +205,10 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return string(pe.Token.Literal)
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -182,6 +233,10 @@ func (ie *InfixExpression) TokenLiteral() string {
 	return string(ie.Token.Literal)
 }
 
+func (ie *InfixExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -205,6 +260,10 @@ func (b *Boolean) TokenLiteral() string {
 	return string(b.Token.Literal)
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
 func (b *Boolean) String() string {
 	return string(b.Token.Literal)
 }
@@ -222,6 +281,10 @@ func (ie *IfExpression) TokenLiteral() string {
 	return string(ie.Token.Literal)
 }
 
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -249,6 +312,10 @@ func (bs *BlockStatement) TokenLiteral() string {
 	return string(bs.Token.Literal)
 }
 
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -263,6 +330,8 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// name the literal is bound to by a let statement, if any
+	Name string
 }
 
 func (fl *FunctionLiteral) ExpressionNode() {}
@@ -271,6 +340,10 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return string(fl.Token.Literal)
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -302,6 +375,10 @@ func (ce *CallExpression) TokenLiteral() string {
 	return string(ce.Token.Literal)
 }
 
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Token.Pos
+}
+
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -330,10 +407,47 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return string(sl.Token.Literal)
 }
 
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
 func (sl *StringLiteral) String() string {
 	return string(sl.Token.Literal)
 }
 
+// String with embedded expressions, such as "Hello ${name}". Parts
+// alternate between string literals and embedded expressions.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) ExpressionNode() {}
+
+func (is *InterpolatedString) TokenLiteral() string {
+	return string(is.Token.Literal)
+}
+
+func (is *InterpolatedString) Pos() token.Position {
+	return is.Token.Pos
+}
+
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if s, ok := part.(*StringLiteral); ok {
+			out.WriteString(s.Value)
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -345,6 +459,10 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return string(al.Token.Literal)
 }
 
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -373,6 +491,10 @@ func (il *IndexExpression) TokenLiteral() string {
 	return string(il.Token.Literal)
 }
 
+func (il *IndexExpression) Pos() token.Position {
+	return il.Token.Pos
+}
+
 func (il *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -396,6 +518,10 @@ func (hl *HashLiteral) TokenLiteral() string {
 	return string(hl.Token.Literal)
 }
 
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -411,3 +537,132 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) StatementNode() {}
+
+func (ws *WhileStatement) TokenLiteral() string {
+	return string(ws.Token.Literal)
+}
+
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+type ForStatement struct {
+	Token token.Token
+	// the loop variable, or the index/key when Value is set
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) StatementNode() {}
+
+func (fs *ForStatement) TokenLiteral() string {
+	return string(fs.Token.Literal)
+}
+
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fs.Key.String())
+	if fs.Value != nil {
+		out.WriteString(", ")
+		out.WriteString(fs.Value.String())
+	}
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) StatementNode() {}
+
+func (bs *BreakStatement) TokenLiteral() string {
+	return string(bs.Token.Literal)
+}
+
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) StatementNode() {}
+
+func (cs *ContinueStatement) TokenLiteral() string {
+	return string(cs.Token.Literal)
+}
+
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+
+type AssignExpression struct {
+	Token token.Token
+	// an *Identifier or an *IndexExpression
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) ExpressionNode() {}
+
+func (ae *AssignExpression) TokenLiteral() string {
+	return string(ae.Token.Literal)
+}
+
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Token.Pos
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"interpreter/token"
@@ -26,3 +27,83 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestFprint(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IDENTIFIER, Literal: []byte("x"), Pos: token.Position{Line: 1, Column: 1}},
+				Expression: &InfixExpression{
+					Token:    token.Token{Type: token.PLUS, Literal: []byte("+"), Pos: token.Position{Line: 1, Column: 3}},
+					Operator: "+",
+					Left: &Identifier{
+						Token: token.Token{Type: token.IDENTIFIER, Literal: []byte("x"), Pos: token.Position{Line: 1, Column: 1}},
+						Value: "x",
+					},
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: []byte("1"), Pos: token.Position{Line: 1, Column: 5}},
+						Value: 1,
+					},
+				},
+			},
+		},
+	}
+
+	var out strings.Builder
+	if err := Fprint(&out, program); err != nil {
+		t.Fatalf("Fprint failed: %s", err)
+	}
+	expected := `Program 1:1
+  Statements[0]: ExpressionStatement 1:1
+    Expression: InfixExpression 1:3 Operator="+"
+      Left: Identifier 1:1 Value="x"
+      Right: IntegerLiteral 1:5 Value=1
+`
+	if out.String() != expected {
+		t.Errorf("Fprint wrong. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENTIFIER, Literal: []byte(name)}, Value: name}
+	}
+	// let f = fn(a) { a + b }; f(c)
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("a")},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{Function: ident("f"), Arguments: []Expression{ident("c")}}},
+		},
+	}
+
+	var names []string
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+	if strings.Join(names, " ") != "f a a b f c" {
+		t.Errorf("wrong identifiers visited. got=%q", names)
+	}
+
+	names = nil
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, ok := node.(*FunctionLiteral)
+		return !ok
+	})
+	if strings.Join(names, " ") != "f f c" {
+		t.Errorf("function literal not skipped. got=%q", names)
+	}
+}
@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Writes the tree rooted at node to w, one node per line and indented by
+// depth. Each line names the field holding the node, its type, its position
+// and the fields holding plain values, as in
+//
+//	Left: IntegerLiteral 1:1 Value=1
+func Fprint(w io.Writer, node Node) error {
+	var out strings.Builder
+	printNode(&out, "", node, 0)
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func printNode(out *strings.Builder, label string, node Node, depth int) {
+	type child struct {
+		label string
+		node  Node
+	}
+	var children []child
+
+	v := reflect.ValueOf(node).Elem()
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+	out.WriteString(v.Type().Name())
+	if pos := node.Pos(); pos.IsValid() {
+		fmt.Fprintf(out, " %d:%d", pos.Line, pos.Column)
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		field := v.Field(i)
+		if name == "Token" {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Interface, reflect.Pointer:
+			if n, ok := asNode(field); ok {
+				children = append(children, child{name, n})
+			}
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				if n, ok := asNode(field.Index(j)); ok {
+					children = append(children, child{fmt.Sprintf("%s[%d]", name, j), n})
+				}
+			}
+		case reflect.Map:
+			// hash pairs, in the order they were written
+			keys := field.MapKeys()
+			sort.Slice(keys, func(a, b int) bool {
+				return keys[a].Interface().(Node).Pos().Offset < keys[b].Interface().(Node).Pos().Offset
+			})
+			for j, key := range keys {
+				k, _ := asNode(key)
+				value, _ := asNode(field.MapIndex(key))
+				children = append(children,
+					child{fmt.Sprintf("%s[%d].Key", name, j), k},
+					child{fmt.Sprintf("%s[%d].Value", name, j), value})
+			}
+		case reflect.String:
+			fmt.Fprintf(out, " %s=%q", name, field.String())
+		default:
+			fmt.Fprintf(out, " %s=%v", name, field.Interface())
+		}
+	}
+	out.WriteString("\n")
+
+	for _, c := range children {
+		if c.node != nil {
+			printNode(out, c.label, c.node, depth+1)
+		}
+	}
+}
+
+// Returns the node held by v, reporting false if it holds none
+func asNode(v reflect.Value) (Node, bool) {
+	if v.IsNil() {
+		return nil, false
+	}
+	node, ok := v.Interface().(Node)
+	return node, ok
+}
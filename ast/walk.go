@@ -0,0 +1,85 @@
+package ast
+
+// Traverses the tree rooted at node depth first, calling f for each node
+// before its children, which are skipped if f returns false. Hash pairs are
+// visited in no particular order.
+func Inspect(node Node, f func(Node) bool) {
+	if !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Inspect(stmt, f)
+		}
+	case *LetStatement:
+		Inspect(node.Name, f)
+		inspectExpression(node.Value, f)
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+	case *WhileStatement:
+		inspectExpression(node.Condition, f)
+		Inspect(node.Body, f)
+	case *ForStatement:
+		Inspect(node.Key, f)
+		if node.Value != nil {
+			Inspect(node.Value, f)
+		}
+		inspectExpression(node.Iterable, f)
+		Inspect(node.Body, f)
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+	case *AssignExpression:
+		inspectExpression(node.Target, f)
+		inspectExpression(node.Value, f)
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		Inspect(node.Consequence, f)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, f)
+		}
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Inspect(param, f)
+		}
+		Inspect(node.Body, f)
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		for _, arg := range node.Arguments {
+			inspectExpression(arg, f)
+		}
+	case *InterpolatedString:
+		for _, part := range node.Parts {
+			inspectExpression(part, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			inspectExpression(el, f)
+		}
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+	case *HashLiteral:
+		for key, value := range node.Pairs {
+			inspectExpression(key, f)
+			inspectExpression(value, f)
+		}
+	}
+}
+
+// Inspects expression unless it is missing
+func inspectExpression(expression Expression, f func(Node) bool) {
+	if expression != nil {
+		Inspect(expression, f)
+	}
+}
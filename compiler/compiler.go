@@ -0,0 +1,758 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/evaluator"
+	"interpreter/object"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// loops enclosing the code being compiled, innermost last
+	loops []*Loop
+}
+
+// Loop being compiled, for break and continue statements to jump out of
+type Loop struct {
+	// position continue statements jump to
+	continueTarget int
+	// positions of the jumps of break statements, patched once the end of
+	// the loop is known
+	breaks []int
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+// Output of the compiler, ready to be executed by the virtual machine
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	// names of the global variables by slot index, for error messages
+	GlobalNames []string
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+}
+
+var prefixOpcodes = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+	"~": code.OpBitNot,
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// Creates a compiler that keeps the globals and constants of earlier
+// compilations, as needed by the REPL
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+		// a program ending in a statement other than an expression has no
+		// result, even if an earlier expression statement set one
+		if len(node.Statements) > 0 && !c.lastInstructionIs(code.OpPop) &&
+			!c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpNone)
+			c.emit(code.OpPop)
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.setSymbol(c.symbolTable.Define(node.Name.Value))
+
+	case *ast.WhileStatement:
+		loopStart := len(c.currentInstructions())
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileLoopBody(node.Body, loopStart)
+		if err != nil {
+			return err
+		}
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement:
+		loop, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.continueTarget)
+
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+		}
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.PrefixExpression:
+		op, ok := prefixOpcodes[node.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+		}
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// emit with a bogus offset that is patched once the target is known
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileBlockValue(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.compileBlockValue(node.Alternative)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// may be defined later on; the VM reports it if it is still
+			// unbound when read
+			symbol = c.symbolTable.Outermost().Define(node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		// map iteration order is random, sort for reproducible bytecode
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.AssignExpression:
+		return c.compileAssignment(node)
+
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+		c.symbolTable.KeepInCells(capturedNames(node.Body))
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		localNames := c.symbolTable.Names()
+		cells := c.symbolTable.CellSlots()
+		instructions := c.leaveScope()
+
+		freeNames := []string{}
+		for _, s := range freeSymbols {
+			c.loadCaptured(s)
+			freeNames = append(freeNames, s.Name)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     len(localNames),
+			NumParameters: len(node.Parameters),
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
+			Cells:         cells,
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	default:
+		return fmt.Errorf("%s: cannot compile %T", node.Pos(), node)
+	}
+
+	return nil
+}
+
+// Compiles an assignment, leaving the assigned value on the stack
+func (c *Compiler) compileAssignment(node *ast.AssignExpression) error {
+	operator := 0
+	if node.Operator != "=" {
+		op, ok := infixOpcodes[strings.TrimSuffix(node.Operator, "=")]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+		}
+		operator = int(op)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			// may be declared later on; the VM reports it if it is still
+			// unbound when assigned
+			symbol = c.symbolTable.Outermost().Define(target.Value)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emit(code.OpAssignGlobal, symbol.Index, operator)
+		case LocalScope:
+			if symbol.Cell {
+				c.emit(code.OpAssignLocalCell, symbol.Index, operator)
+			} else {
+				c.emit(code.OpAssignLocal, symbol.Index, operator)
+			}
+		case FreeScope:
+			if !symbol.Cell {
+				// the function being defined, referred to by its own name
+				return fmt.Errorf("%s: cannot assign to %s", node.Pos(), target.Value)
+			}
+			c.emit(code.OpAssignFreeCell, symbol.Index, operator)
+		default:
+			return fmt.Errorf("%s: cannot assign to %s", node.Pos(), target.Value)
+		}
+
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex, operator)
+
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", node.Pos(), node.Target.String())
+	}
+
+	return nil
+}
+
+// Compiles a for-in loop. The iterator is kept in a hidden variable rather
+// than on the stack, so that break can leave the loop from anywhere.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIterator)
+	// not a valid identifier, and one per nesting level
+	iterator := c.symbolTable.Define(fmt.Sprintf("$iterator%d", len(c.scopes[c.scopeIndex].loops)))
+	c.setSymbol(iterator)
+
+	loopStart := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	numVars := 1
+	if node.Value != nil {
+		numVars = 2
+	}
+	iterNextPos := c.emit(code.OpIterNext, 9999, numVars)
+	if node.Value != nil {
+		c.setSymbol(c.symbolTable.Define(node.Value.Value))
+	}
+	c.setSymbol(c.symbolTable.Define(node.Key.Value))
+
+	err = c.compileLoopBody(node.Body, loopStart)
+	if err != nil {
+		return err
+	}
+	c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, len(c.currentInstructions()), numVars))
+	return nil
+}
+
+// Compiles the body of a loop jumping back to loopStart, where continue
+// statements jump to as well. Break statements jump past the body.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, loopStart int) error {
+	scope := &c.scopes[c.scopeIndex]
+	loop := &Loop{continueTarget: loopStart}
+	scope.loops = append(scope.loops, loop)
+
+	err := c.Compile(body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart)
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// Returns the innermost loop, for the break or continue statement node
+func (c *Compiler) currentLoop(node ast.Node) (*Loop, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil, fmt.Errorf("%s: %s outside of a loop", node.Pos(), node.TokenLiteral())
+	}
+	return loops[len(loops)-1], nil
+}
+
+// Compiles && and || so that the right operand is only evaluated when the
+// left one does not decide the result. Both leave a boolean on the stack.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "&&" {
+		err = c.compileTruthiness(node.Right)
+		if err != nil {
+			return err
+		}
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		return nil
+	}
+
+	c.emit(code.OpTrue)
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	err = c.compileTruthiness(node.Right)
+	if err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// Compiles node and converts its value to a boolean
+func (c *Compiler) compileTruthiness(node ast.Expression) error {
+	err := c.Compile(node)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+// Compiles a block used as the value of an expression, leaving exactly one
+// value on the stack, which is missing if the block does not end in an
+// expression statement
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNone)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.Outermost().Names(),
+	}
+}
+
+// Returns the symbol table, to be reused for a later compilation
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex += 1
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex -= 1
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// Stores the value on top of the stack in the variable of s
+func (c *Compiler) setSymbol(s Symbol) {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Cell:
+		c.emit(code.OpSetLocalCell, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	if s.Cell {
+		if s.Scope == FreeScope {
+			c.emit(code.OpGetFreeCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocalCell, s.Index)
+		}
+		return
+	}
+
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// Pushes what a closure captures of the variable s: the cell holding it if
+// it is kept in one, so that assignments are seen on both sides
+func (c *Compiler) loadCaptured(s Symbol) {
+	s.Cell = false
+	c.loadSymbol(s)
+}
+
+// Returns the names referred to inside the functions nested in body. The
+// locals of the function around them by those names are kept in cells, as
+// the nested functions may capture them.
+func capturedNames(body *ast.BlockStatement) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(body, func(node ast.Node) bool {
+		fn, ok := node.(*ast.FunctionLiteral)
+		if !ok {
+			return true
+		}
+		ast.Inspect(fn, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+			return true
+		})
+		return false
+	})
+	return names
+}
@@ -0,0 +1,137 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// whether the slot holds an *object.Cell with the value, shared with
+	// the closures capturing the variable
+	Cell bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string
+	// names of the locals to keep in cells
+	captured map[string]bool
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (s *SymbolTable) scope() SymbolScope {
+	if s.Outer == nil {
+		return GlobalScope
+	}
+	return LocalScope
+}
+
+// Binds name in this table. Redefining a name already bound in the same
+// scope reuses its slot.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope == s.scope() {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: s.scope()}
+	symbol.Cell = symbol.Scope == LocalScope && s.captured[name]
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.numDefinitions += 1
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	// the closure gets the cell of a variable kept in one
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Cell: original.Cell}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
+
+// Returns the names of the symbols defined in this table by slot index
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
+// Keeps the locals named in captured in cells when they are defined
+func (s *SymbolTable) KeepInCells(captured map[string]bool) {
+	s.captured = captured
+}
+
+// Returns the slots of the symbols defined in this table that are kept in
+// cells
+func (s *SymbolTable) CellSlots() []int {
+	var slots []int
+	for i, name := range s.names {
+		if s.scope() == LocalScope && s.captured[name] {
+			slots = append(slots, i)
+		}
+	}
+	return slots
+}
+
+// Returns the table of the global scope
+func (s *SymbolTable) Outermost() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package diagnostic
+
+import (
+	"interpreter/token"
+)
+
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+	NOTE
+)
+
+func (s Severity) String() string {
+	switch s {
+	case ERROR:
+		return "error"
+	case WARNING:
+		return "warning"
+	case NOTE:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// Codes identifying the kind of a diagnostic
+const (
+	UNTERMINATED_COMMENT = "L001"
+	READ_FAILED          = "L002"
+	UNTERMINATED_STRING  = "L003"
+	INVALID_ESCAPE       = "L004"
+	MALFORMED_NUMBER     = "L005"
+
+	UNEXPECTED_TOKEN    = "P001"
+	NO_PREFIX_PARSE     = "P002"
+	INVALID_INTEGER     = "P003"
+	OUTSIDE_LOOP        = "P004"
+	INVALID_ASSIGNMENT  = "P005"
+	INVALID_NUMBER      = "P006"
+	EMPTY_INTERPOLATION = "P007"
+	NUMBER_OUT_OF_RANGE = "P008"
+
+	IDENTIFIER_NOT_FOUND = "R001"
+	TYPE_MISMATCH        = "R002"
+	UNKNOWN_OPERATOR     = "R003"
+	NOT_A_FUNCTION       = "R004"
+	UNUSABLE_HASH_KEY    = "R005"
+	INDEX_NOT_SUPPORTED  = "R006"
+	UNDECLARED_VARIABLE  = "R007"
+	INDEX_OUT_OF_RANGE   = "R008"
+	DIVISION_BY_ZERO     = "R009"
+	WRONG_ARGUMENT_COUNT = "R010"
+	INVALID_OPERAND      = "R011"
+	CANCELED             = "R012"
+	STEP_LIMIT_EXCEEDED  = "R013"
+	CALL_DEPTH_EXCEEDED  = "R014"
+	INTERNAL_ERROR       = "R015"
+)
+
+// Range of source text covered by a diagnostic. End is exclusive and may be
+// invalid, in which case the span covers the single position Start.
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Returns the span covered by tok
+func TokenSpan(tok token.Token) Span {
+	return SpanOf(tok.Pos, len(tok.Literal))
+}
+
+// Returns the span of length bytes starting at pos on a single line
+func SpanOf(pos token.Position, length int) Span {
+	if !pos.IsValid() {
+		return Span{Start: pos}
+	}
+	end := pos
+	end.Column += length
+	end.Offset += length
+	return Span{Start: pos, End: end}
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Span     Span
+	Message  string
+	Notes    []string
+	Hints    []string
+}
+
+// Formats the diagnostic as "position: message"
+func (d *Diagnostic) String() string {
+	if d.Span.Start.IsValid() {
+		return d.Span.Start.String() + ": " + d.Message
+	}
+	return d.Message
+}
+
+func (d *Diagnostic) Error() string {
+	return d.String()
+}
@@ -0,0 +1,92 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"interpreter/token"
+)
+
+func TestRender(t *testing.T) {
+	source := []byte("let a = 5;\nlet b = a + foo;\n")
+	d := &Diagnostic{
+		Severity: ERROR,
+		Code:     IDENTIFIER_NOT_FOUND,
+		Span:     SpanOf(token.Position{Filename: "main.monkey", Line: 2, Column: 13, Offset: 23}, 3),
+		Message:  "identifier not found: foo",
+		Hints:    []string{"declare foo with let before using it"},
+	}
+
+	var out bytes.Buffer
+	Render(&out, source, []*Diagnostic{d})
+
+	expected := `main.monkey:2:13: error[R001]: identifier not found: foo
+  |
+2 | let b = a + foo;
+  |             ^~~
+  = hint: declare foo with let before using it
+`
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderWithoutSource(t *testing.T) {
+	d := &Diagnostic{Severity: WARNING, Message: "something odd", Notes: []string{"a note"}}
+
+	var out bytes.Buffer
+	Render(&out, nil, []*Diagnostic{d})
+
+	expected := "warning: something odd\n  = note: a note\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestRenderKeepsTabs(t *testing.T) {
+	source := []byte("\tx +;")
+	d := &Diagnostic{
+		Severity: ERROR,
+		Span:     Span{Start: token.Position{Line: 1, Column: 5, Offset: 4}},
+		Message:  "missing operand",
+	}
+
+	var out bytes.Buffer
+	Render(&out, source, []*Diagnostic{d})
+
+	expected := "1:5: error: missing operand\n  |\n1 | \tx +;\n  | \t   ^\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	d := &Diagnostic{
+		Severity: ERROR,
+		Code:     UNEXPECTED_TOKEN,
+		Span:     SpanOf(token.Position{Line: 1, Column: 7, Offset: 6}, 1),
+		Message:  "expected next token to be =, got INT instead",
+	}
+
+	var out bytes.Buffer
+	if err := RenderJSON(&out, []*Diagnostic{d}); err != nil {
+		t.Fatalf("RenderJSON returned error: %s", err)
+	}
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %s", err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(decoded))
+	}
+	if decoded[0]["severity"] != "error" || decoded[0]["code"] != "P001" {
+		t.Errorf("wrong severity or code. got=%v", decoded[0])
+	}
+	span := decoded[0]["span"].(map[string]interface{})
+	end := span["end"].(map[string]interface{})
+	if end["column"] != float64(8) {
+		t.Errorf("wrong end column. got=%v", end["column"])
+	}
+}
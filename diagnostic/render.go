@@ -0,0 +1,153 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"interpreter/token"
+)
+
+// Writes diagnostics in a human readable form, quoting the offending line of
+// source with the span underlined. source may be nil, in which case only the
+// header, notes and hints are written.
+func Render(w io.Writer, source []byte, diags []*Diagnostic) {
+	for _, d := range diags {
+		renderOne(w, source, d)
+	}
+}
+
+func renderOne(w io.Writer, source []byte, d *Diagnostic) {
+	var out bytes.Buffer
+
+	start := d.Span.Start
+	if start.IsValid() {
+		out.WriteString(start.String() + ": ")
+	}
+	out.WriteString(d.Severity.String())
+	if d.Code != "" {
+		out.WriteString("[" + d.Code + "]")
+	}
+	out.WriteString(": " + d.Message + "\n")
+
+	gutter := 1
+	if line, ok := sourceLine(source, start); ok {
+		number := strconv.Itoa(start.Line)
+		gutter = len(number)
+		pad := strings.Repeat(" ", gutter)
+
+		out.WriteString(pad + " |\n")
+		out.WriteString(number + " | " + string(line) + "\n")
+		out.WriteString(pad + " | " + underline(line, d.Span) + "\n")
+	}
+
+	pad := strings.Repeat(" ", gutter)
+	for _, note := range d.Notes {
+		out.WriteString(pad + " = note: " + note + "\n")
+	}
+	for _, hint := range d.Hints {
+		out.WriteString(pad + " = hint: " + hint + "\n")
+	}
+
+	w.Write(out.Bytes())
+}
+
+// Returns the line of source containing pos, without its line terminator
+func sourceLine(source []byte, pos token.Position) ([]byte, bool) {
+	if source == nil || !pos.IsValid() || pos.Offset > len(source) {
+		return nil, false
+	}
+	lineStart := pos.Offset - (pos.Column - 1)
+	if lineStart < 0 {
+		return nil, false
+	}
+	line := source[lineStart:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	return bytes.TrimRight(line, "\r"), true
+}
+
+// Builds the caret line marking span beneath line
+func underline(line []byte, span Span) string {
+	var out strings.Builder
+
+	column := span.Start.Column - 1
+	for i := 0; i < column && i < len(line); i++ {
+		// keep tabs so the caret lines up with the quoted source
+		if line[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	for i := len(line); i < column; i++ {
+		out.WriteByte(' ')
+	}
+
+	width := 1
+	if span.End.IsValid() && span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	}
+	out.WriteByte('^')
+	out.WriteString(strings.Repeat("~", width-1))
+
+	return out.String()
+}
+
+type jsonPosition struct {
+	Filename string `json:"file,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+}
+
+type jsonSpan struct {
+	Start jsonPosition  `json:"start"`
+	End   *jsonPosition `json:"end,omitempty"`
+}
+
+type jsonDiagnostic struct {
+	Severity string   `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message"`
+	Span     jsonSpan `json:"span"`
+	Notes    []string `json:"notes,omitempty"`
+	Hints    []string `json:"hints,omitempty"`
+}
+
+func toJSONPosition(pos token.Position) jsonPosition {
+	return jsonPosition{Filename: pos.Filename, Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+}
+
+// Writes diagnostics as a JSON array for consumption by editors and tools
+func RenderJSON(w io.Writer, diags []*Diagnostic) error {
+	out := make([]jsonDiagnostic, 0, len(diags))
+
+	for _, d := range diags {
+		jd := jsonDiagnostic{
+			Severity: d.Severity.String(),
+			Code:     d.Code,
+			Message:  d.Message,
+			Span:     jsonSpan{Start: toJSONPosition(d.Span.Start)},
+			Notes:    d.Notes,
+			Hints:    d.Hints,
+		}
+		if d.Span.End.IsValid() {
+			end := toJSONPosition(d.Span.End)
+			jd.Span.End = &end
+		}
+		out = append(out, jd)
+	}
+
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("could not encode diagnostics: %w", err)
+	}
+	encoded = append(encoded, '\n')
+	_, err = w.Write(encoded)
+	return err
+}
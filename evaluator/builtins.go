@@ -2,7 +2,14 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"interpreter/diagnostic"
 	"interpreter/object"
 )
 
@@ -17,9 +24,11 @@ var (
 
 				switch arg := args[0].(type) {
 				case *object.String:
-					return &object.Integer{Value: int64(len(arg.Value))}
+					return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 				case *object.Array:
 					return &object.Integer{Value: int64(len(arg.Elements))}
+				case *object.Range:
+					return object.NormalizeInteger(new(big.Int).SetUint64(arg.Len()))
 				default:
 					return newError("argument to `len` not supported, got %s", args[0].Type())
 				}
@@ -84,19 +93,275 @@ var (
 				arr := args[0].(*object.Array)
 				length := len(arr.Elements)
 				newElements := make([]object.Object, length+1, length+1)
-				copy(newElements, arr.Elements[1:length])
+				copy(newElements, arr.Elements)
 				newElements[length] = args[1]
 				return &object.Array{Elements: newElements}
 			},
 		},
-		"print": {
+		"slice": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=2..3", len(args))
+				}
+				bounds := make([]int64, len(args)-1)
+				for i, arg := range args[1:] {
+					integer, ok := arg.(*object.Integer)
+					if !ok {
+						return newError("bounds of `slice` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				switch arg := args[0].(type) {
+				case *object.String:
+					// bounds count characters, not bytes
+					chars := []rune(arg.Value)
+					start, end, err := sliceBounds(bounds, len(chars))
+					if err != nil {
+						return err
+					}
+					return &object.String{Value: string(chars[start:end])}
+				case *object.Array:
+					start, end, err := sliceBounds(bounds, len(arg.Elements))
+					if err != nil {
+						return err
+					}
+					elements := make([]object.Object, end-start)
+					copy(elements, arg.Elements[start:end])
+					return &object.Array{Elements: elements}
+				default:
+					return newError("argument to `slice` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+		"bytes": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `bytes` must be STRING, got %s", args[0].Type())
+				}
+				elements := make([]object.Object, len(str.Value))
+				for i := 0; i < len(str.Value); i++ {
+					elements[i] = &object.Integer{Value: int64(str.Value[i])}
+				}
+				return &object.Array{Elements: elements}
+			},
+		},
+		"bytelen": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				str, ok := args[0].(*object.String)
+				if !ok {
+					return newError("argument to `bytelen` must be STRING, got %s", args[0].Type())
+				}
+				return &object.Integer{Value: int64(len(str.Value))}
+			},
+		},
+		"range": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments. got=%d, want=1..3", len(args))
+				}
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					if _, ok := arg.(*object.BigInteger); ok {
+						return newError("argument to `range` too large: %s", arg.Inspect())
+					}
+					integer, ok := arg.(*object.Integer)
+					if !ok {
+						return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				r := &object.Range{Start: 0, Step: 1}
+				switch len(bounds) {
+				case 1:
+					r.End = bounds[0]
+				case 2:
+					r.Start, r.End = bounds[0], bounds[1]
+				case 3:
+					r.Start, r.End, r.Step = bounds[0], bounds[1], bounds[2]
+				}
+				if r.Step == 0 {
+					return newError("step of `range` must not be zero")
+				}
+				return r
+			},
+		},
+		"int": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *object.Integer, *object.BigInteger:
+					return arg
+				case *object.Float:
+					return floatToInteger("int", math.Trunc(arg.Value))
+				case *object.String:
+					value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+					if !ok {
+						return newError("could not convert %q to INTEGER", arg.Value)
+					}
+					return object.NormalizeInteger(value)
+				case *object.Boolean:
+					if arg.Value {
+						return &object.Integer{Value: 1}
+					}
+					return &object.Integer{Value: 0}
+				default:
+					return newError("argument to `int` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+		"float": {
 			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				switch arg := args[0].(type) {
+				case *object.Float:
+					return arg
+				case *object.Integer, *object.BigInteger:
+					return &object.Float{Value: toFloat(arg)}
+				case *object.String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("could not convert %q to FLOAT", arg.Value)
+					}
+					return &object.Float{Value: value}
+				default:
+					return newError("argument to `float` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+		"round": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1..2", len(args))
+				}
+				if len(args) == 2 {
+					// round(x, digits) keeps a float with that many decimals
+					digits, ok := args[1].(*object.Integer)
+					if !ok || !isNumber(args[0]) {
+						return newError("arguments to `round` must be FLOAT and INTEGER, got %s and %s",
+							args[0].Type(), args[1].Type())
+					}
+					scale := math.Pow(10, float64(digits.Value))
+					return &object.Float{Value: math.Round(toFloat(args[0])*scale) / scale}
+				}
+				return roundToInteger("round", args[0], math.Round)
+			},
+		},
+		"floor": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				return roundToInteger("floor", args[0], math.Floor)
+			},
+		},
+		"ceil": {
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				return roundToInteger("ceil", args[0], math.Ceil)
+			},
+		},
+		"print": {
+			HostFn: func(host *object.Host, args ...object.Object) object.Object {
 				for _, arg := range args {
-					fmt.Println(arg.Inspect())
+					fmt.Fprintln(host.Out(), arg.Inspect())
 				}
 
 				return NULL
 			},
 		},
+		"eprint": {
+			HostFn: func(host *object.Host, args ...object.Object) object.Object {
+				for _, arg := range args {
+					fmt.Fprintln(host.Err(), arg.Inspect())
+				}
+
+				return NULL
+			},
+		},
+		"input": {
+			HostFn: func(host *object.Host, args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0..1", len(args))
+				}
+				if len(args) == 1 {
+					fmt.Fprint(host.Out(), args[0].Inspect())
+				}
+
+				line, ok := host.ReadLine()
+				if !ok {
+					return NULL
+				}
+				return &object.String{Value: line}
+			},
+		},
 	}
 )
+
+// Checks the start and optional end given to `slice` against the length of
+// the sliced value, with the end defaulting to the length
+func sliceBounds(bounds []int64, length int) (int, int, *object.Error) {
+	start, end := bounds[0], int64(length)
+	if len(bounds) == 2 {
+		end = bounds[1]
+	}
+	if start < 0 || start > end || end > int64(length) {
+		return 0, 0, newCodedError(diagnostic.INDEX_OUT_OF_RANGE,
+			"slice bounds out of range: [%d:%d] with length %d", start, end, length)
+	}
+	return int(start), int(end), nil
+}
+
+// Rounds a number to an integer with the given rounding function
+func roundToInteger(name string, arg object.Object, round func(float64) float64) object.Object {
+	switch arg := arg.(type) {
+	case *object.Integer, *object.BigInteger:
+		return arg
+	case *object.Float:
+		return floatToInteger(name, round(arg.Value))
+	default:
+		return newError("argument to `%s` must be a number, got %s", name, arg.Type())
+	}
+}
+
+// Converts an integral float to an integer, failing for infinities and NaN
+func floatToInteger(name string, value float64) object.Object {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return newError("result of `%s` out of INTEGER range: %s", name, (&object.Float{Value: value}).Inspect())
+	}
+	if value >= math.MinInt64 && value < math.MaxInt64 {
+		return &object.Integer{Value: int64(value)}
+	}
+	integer, _ := big.NewFloat(value).Int(nil)
+	return object.NormalizeInteger(integer)
+}
+
+// Returns the builtin function bound to name
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// Returns the names of all builtin functions in sorted order
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,18 +2,35 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/object"
+	"interpreter/token"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = object.NULL
+	TRUE     = object.TRUE
+	FALSE    = object.FALSE
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// Evaluates node in env. Stops with an error once the host of env runs out
+// of steps or its context is done, each node evaluated counting as a step.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if host := env.Host(); host != nil {
+		if err := host.Step(); err != nil {
+			return withPos(err, node)
+		}
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
@@ -31,6 +48,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
@@ -42,18 +62,21 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withPos(evalPrefixExpression(node.Operator, right), node)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return withPos(evalInfixExpression(node.Operator, left, right), node)
 
 	case *ast.BlockStatement:
 		return evalBlockStatment(node, env)
@@ -61,6 +84,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
@@ -69,7 +104,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		env.Set(node.Name.Value, val)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return withPos(evalIdentifier(node, env), node)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
@@ -85,7 +120,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return withPos(evalCall(node, function, args, env.Host()), node)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -94,6 +129,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 
+	case *ast.InterpolatedString:
+		parts := evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isError(parts[0]) {
+			return parts[0]
+		}
+		return Interpolate(parts)
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -103,10 +145,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return withPos(evalIndexExpression(left, index), node)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return withPos(evalHashLiteral(node, env), node)
+
+	case *ast.AssignExpression:
+		return withPos(evalAssignExpression(node, env), node)
 	}
 
 	return nil
@@ -137,7 +182,8 @@ func evalBlockStatment(block *ast.BlockStatement, env *object.Environment) objec
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -159,8 +205,10 @@ func evalPrefixExpression(oper string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitwiseNotOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", oper, right.Type())
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: %s%s", oper, right.Type())
 	}
 }
 
@@ -178,54 +226,294 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.NormalizeInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInteger:
+		return object.NormalizeInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: -%s", right.Type())
+	}
+}
+
+func evalBitwiseNotOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInteger:
+		return object.NormalizeInteger(new(big.Int).Not(right.Value))
+	default:
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: ~%s", right.Type())
+	}
+}
+
+// Evaluates && and ||, only evaluating the right operand when the left one
+// does not decide the result
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
 }
 
 func evalInfixExpression(oper string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(oper, left, right)
+	case isNumber(left) && isNumber(right):
+		// mixed integer and float operands are promoted to float
+		return evalFloatInfixExpression(oper, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(oper, left, right)
 	case oper == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case oper == "!=":
 		return nativeBoolToBooleanObject(left != right)
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(oper, left, right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), oper, right.Type())
+		return newCodedError(diagnostic.TYPE_MISMATCH, "type mismatch: %s %s %s", left.Type(), oper, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), oper, right.Type())
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), oper, right.Type())
 	}
 }
 
 func evalIntegerInfixExpression(oper string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+	if (oper == "/" || oper == "%") && isZero(right) {
+		return newCodedError(diagnostic.DIVISION_BY_ZERO, "division by zero: %s %s %s", left.Inspect(), oper, right.Inspect())
+	}
+
+	l, leftSmall := left.(*object.Integer)
+	r, rightSmall := right.(*object.Integer)
+	// shifts and powers can grow without bound, so they always go through
+	// the big integer path where the result size is checked
+	if !leftSmall || !rightSmall || oper == "<<" || oper == ">>" || oper == "**" {
+		return evalBigIntegerInfixExpression(oper, left, right)
+	}
+	leftVal := l.Value
+	rightVal := r.Value
 
 	switch oper {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		sum := leftVal + rightVal
+		if (rightVal > 0 && sum < leftVal) || (rightVal < 0 && sum > leftVal) {
+			return evalBigIntegerInfixExpression(oper, left, right)
+		}
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		difference := leftVal - rightVal
+		if (rightVal > 0 && difference > leftVal) || (rightVal < 0 && difference < leftVal) {
+			return evalBigIntegerInfixExpression(oper, left, right)
+		}
+		return &object.Integer{Value: difference}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		product := leftVal * rightVal
+		if leftVal != 0 && (product/leftVal != rightVal || (leftVal == -1 && rightVal == math.MinInt64)) {
+			return evalBigIntegerInfixExpression(oper, left, right)
+		}
+		return &object.Integer{Value: product}
 	case "/":
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntegerInfixExpression(oper, left, right)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		return &object.Integer{Value: leftVal % rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), oper, right.Type())
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), oper, right.Type())
+	}
+}
+
+// Evaluates integer operations that overflow an int64 or involve a big
+// integer. Results that fit in an int64 are demoted again.
+func evalBigIntegerInfixExpression(oper string, left, right object.Object) object.Object {
+	leftVal, _ := object.ToBigInt(left)
+	rightVal, _ := object.ToBigInt(right)
+
+	switch oper {
+	case "+":
+		return object.NormalizeInteger(leftVal.Add(leftVal, rightVal))
+	case "-":
+		return object.NormalizeInteger(leftVal.Sub(leftVal, rightVal))
+	case "*":
+		return object.NormalizeInteger(leftVal.Mul(leftVal, rightVal))
+	case "/":
+		// Quo and Rem truncate towards zero like the int64 operators
+		return object.NormalizeInteger(leftVal.Quo(leftVal, rightVal))
+	case "%":
+		return object.NormalizeInteger(leftVal.Rem(leftVal, rightVal))
+	case "&":
+		return object.NormalizeInteger(leftVal.And(leftVal, rightVal))
+	case "|":
+		return object.NormalizeInteger(leftVal.Or(leftVal, rightVal))
+	case "^":
+		return object.NormalizeInteger(leftVal.Xor(leftVal, rightVal))
+	case "<<", ">>":
+		return evalShiftExpression(oper, left, right, leftVal, rightVal)
+	case "**":
+		return evalIntegerPowerExpression(left, right, leftVal, rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), oper, right.Type())
+	}
+}
+
+// Upper bound on the number of bits of integers produced by shifts and
+// exponentiation, so that a single expression cannot exhaust memory
+const maxIntegerBits = 1 << 20
+
+func evalShiftExpression(oper string, left, right object.Object, leftVal, rightVal *big.Int) object.Object {
+	if rightVal.Sign() < 0 {
+		return newCodedError(diagnostic.INVALID_OPERAND, "negative shift amount: %s", right.Inspect())
+	}
+
+	if oper == ">>" {
+		if !rightVal.IsInt64() || rightVal.Int64() > int64(leftVal.BitLen()) {
+			// everything is shifted out, leaving only the sign
+			if leftVal.Sign() < 0 {
+				return &object.Integer{Value: -1}
+			}
+			return &object.Integer{Value: 0}
+		}
+		// Rsh rounds towards negative infinity like the int64 operator
+		return object.NormalizeInteger(leftVal.Rsh(leftVal, uint(rightVal.Int64())))
+	}
+
+	if leftVal.Sign() == 0 {
+		return &object.Integer{Value: 0}
+	}
+	// compared by subtracting, as the sum can overflow
+	if !rightVal.IsInt64() || rightVal.Int64() > maxIntegerBits-int64(leftVal.BitLen()) {
+		return newCodedError(diagnostic.INVALID_OPERAND, "integer too large: %s %s %s", left.Inspect(), oper, right.Inspect())
+	}
+	return object.NormalizeInteger(leftVal.Lsh(leftVal, uint(rightVal.Int64())))
+}
+
+// Raises an integer to an integer power. Negative exponents give a float,
+// as the result is in general not integral.
+func evalIntegerPowerExpression(left, right object.Object, leftVal, rightVal *big.Int) object.Object {
+	if rightVal.Sign() < 0 {
+		if leftVal.Sign() == 0 {
+			return newCodedError(diagnostic.DIVISION_BY_ZERO, "division by zero: %s ** %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: math.Pow(toFloat(left), toFloat(right))}
+	}
+
+	// bases 0, 1 and -1 stay small for every exponent, other bases have at
+	// least two bits. Compared by dividing, as the product can overflow.
+	if leftVal.CmpAbs(big.NewInt(1)) > 0 {
+		if !rightVal.IsInt64() || rightVal.Int64() > maxIntegerBits/int64(leftVal.BitLen()-1) {
+			return newCodedError(diagnostic.INVALID_OPERAND, "integer too large: %s ** %s", left.Inspect(), right.Inspect())
+		}
+	}
+	return object.NormalizeInteger(leftVal.Exp(leftVal, rightVal, nil))
+}
+
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// Returns the value of an integer or float as a float
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+// Reports whether obj is a numeric zero. Big integers never are, as they
+// are only used for values outside the int64 range.
+func isZero(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value == 0
+	case *object.Float:
+		return obj.Value == 0
+	default:
+		return false
+	}
+}
+
+func evalFloatInfixExpression(oper string, left, right object.Object) object.Object {
+	if (oper == "/" || oper == "%") && isZero(right) {
+		return newCodedError(diagnostic.DIVISION_BY_ZERO, "division by zero: %s %s %s", left.Inspect(), oper, right.Inspect())
+	}
+
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch oper {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), oper, right.Type())
 	}
 }
 
@@ -245,6 +533,163 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+// Evaluates one iteration of a loop body. Reports whether the loop must stop,
+// along with the value to hand up for return statements and errors.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var result object.Object
+
+	err := forEach(iterable, func(key, value object.Object) bool {
+		if fs.Value != nil {
+			env.Set(fs.Key.Value, key)
+			env.Set(fs.Value.Value, value)
+		} else if iterable.Type() == object.HASH_OBJ {
+			env.Set(fs.Key.Value, key)
+		} else {
+			env.Set(fs.Key.Value, value)
+		}
+
+		var done bool
+		result, done = evalLoopBody(fs.Body, env)
+		return !done
+	})
+	if err != nil {
+		return withPos(err, fs.Iterable)
+	}
+
+	return result
+}
+
+// Calls fn with each index and element of an array, string or range, or each
+// key and value of a hash, until fn returns false
+func forEach(iterable object.Object, fn func(key, value object.Object) bool) *object.Error {
+	it, err := newIterator(iterable)
+	if err != nil {
+		return err
+	}
+	for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+		if !fn(key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+// Returns an iterator over the indexes and elements of arrays, strings and
+// ranges, or the sorted pairs of hashes
+func newIterator(iterable object.Object) (*object.Iterator, *object.Error) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		i := 0
+		return object.NewIterator(func() (object.Object, object.Object, bool) {
+			if i >= len(iterable.Elements) {
+				return nil, nil, false
+			}
+			i += 1
+			return &object.Integer{Value: int64(i - 1)}, iterable.Elements[i-1], true
+		}, false), nil
+
+	case *object.String:
+		i, offset := 0, 0
+		return object.NewIterator(func() (object.Object, object.Object, bool) {
+			if offset >= len(iterable.Value) {
+				return nil, nil, false
+			}
+			char, size := utf8.DecodeRuneInString(iterable.Value[offset:])
+			offset += size
+			i += 1
+			return &object.Integer{Value: int64(i - 1)}, &object.String{Value: string(char)}, true
+		}, false), nil
+
+	case *object.Range:
+		n := iterable.Len()
+		i := uint64(0)
+		return object.NewIterator(func() (object.Object, object.Object, bool) {
+			if i >= n {
+				return nil, nil, false
+			}
+			i += 1
+			// wraps around in between for the widest ranges, but ends up
+			// at the element, which is in the int64 range
+			value := iterable.Start + int64(i-1)*iterable.Step
+			return &object.Integer{Value: int64(i - 1)}, &object.Integer{Value: value}, true
+		}, false), nil
+
+	case *object.Hash:
+		pairs := sortedPairs(iterable)
+		i := 0
+		return object.NewIterator(func() (object.Object, object.Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			i += 1
+			return pairs[i-1].Key, pairs[i-1].Value, true
+		}, true), nil
+
+	default:
+		return nil, newError("cannot iterate over %s", iterable.Type())
+	}
+}
+
+// Returns the pairs of a hash ordered by key, so that iteration is
+// reproducible
+func sortedPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		ki, kj := pairs[i].Key, pairs[j].Key
+		if ki.Type() != kj.Type() {
+			return ki.Type() < kj.Type()
+		}
+		if a, ok := object.ToBigInt(ki); ok {
+			b, _ := object.ToBigInt(kj)
+			return a.Cmp(b) < 0
+		}
+		return ki.Inspect() < kj.Inspect()
+	})
+
+	return pairs
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -262,6 +707,20 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func newCodedError(code string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Code: code}
+}
+
+// Attaches the position of node to obj if it is an error without one
+func withPos(obj object.Object, node ast.Node) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		span := diagnostic.SpanOf(node.Pos(), len(node.TokenLiteral()))
+		err.Pos = span.Start
+		err.End = span.End
+	}
+	return obj
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -279,7 +738,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newCodedError(diagnostic.IDENTIFIER_NOT_FOUND, "identifier not found: %s", node.Value)
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
@@ -296,18 +755,60 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// Applies function to the arguments of the call expression node, tracking
+// the depth of calls on host so that runaway recursion ends in an error
+// rather than exhausting the Go stack
+func evalCall(node *ast.CallExpression, function object.Object, args []object.Object, host *object.Host) object.Object {
+	return callFunction(calledName(node.Function), node.Pos(), function, args, host)
+}
+
+// Applies function, shown as name, to args in a call frame made at pos
+func callFunction(name string, pos token.Position, function object.Object, args []object.Object, host *object.Host) object.Object {
+	if _, ok := function.(*object.Function); ok && host != nil {
+		if err := host.EnterCall(name, pos); err != nil {
+			return err
+		}
+		defer host.ExitCall()
+	}
+	return applyFunction(function, args, host)
+}
+
+// Returns how the call frame of a call to callee is shown in errors
+func calledName(callee ast.Expression) string {
+	if _, ok := callee.(*ast.FunctionLiteral); ok {
+		return "fn"
+	}
+	return callee.String()
+}
+
+// Returns the error an evaluation stops with when it panicked with r, so
+// that a bug in the interpreter does not bring down its host
+func InternalError(r any) *object.Error {
+	return newCodedError(diagnostic.INTERNAL_ERROR, "internal error: %v", r)
+}
+
+// Calls fn, bound to name, with args on behalf of host. The call counts
+// toward the call depth of host like one made by a script.
+func ApplyFunction(name string, fn object.Object, args []object.Object, host *object.Host) object.Object {
+	return callFunction(name, token.Position{}, fn, args, host)
+}
+
+func applyFunction(fn object.Object, args []object.Object, host *object.Host) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newCodedError(diagnostic.WRONG_ARGUMENT_COUNT,
+				"wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return fn.Call(host, args...)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newCodedError(diagnostic.NOT_A_FUNCTION, "not a function: %s", fn.Type())
 	}
 }
 
@@ -330,30 +831,59 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 func evalStringInfixExpression(oper string, left, right object.Object) object.Object {
-	if oper != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), oper, right.Type())
-	}
-
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 
-	return &object.String{Value: leftVal + rightVal}
+	switch oper {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
+		return newCodedError(diagnostic.UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), oper, right.Type())
+	}
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.ARRAY_OBJ:
+		return newCodedError(diagnostic.INDEX_NOT_SUPPORTED,
+			"array index must be INTEGER, got %s", index.Type())
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ:
+		return newCodedError(diagnostic.INDEX_NOT_SUPPORTED,
+			"string index must be INTEGER, got %s", index.Type())
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newCodedError(diagnostic.INDEX_NOT_SUPPORTED, "index operator not supported: %s", left.Type())
 	}
 }
 
 func evalArrayIndexExpression(left, index object.Object) object.Object {
-	arrayObject := left.(*object.Array)
-	idx := index.(*object.Integer).Value
+	arrayObject, ok := left.(*object.Array)
+	if !ok {
+		return newCodedError(diagnostic.INDEX_NOT_SUPPORTED, "index operator not supported: %s", left.Type())
+	}
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		// a big integer is out of range of any array
+		return NULL
+	}
+	idx := integer.Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	if idx < 0 || idx > max {
@@ -363,6 +893,26 @@ func evalArrayIndexExpression(left, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+// Returns the character at the index of a string as a string, counting
+// characters rather than bytes
+func evalStringIndexExpression(left, index object.Object) object.Object {
+	str := left.(*object.String).Value
+	integer, ok := index.(*object.Integer)
+	if !ok || integer.Value < 0 {
+		// a big integer is out of range of any string
+		return NULL
+	}
+	idx := integer.Value
+
+	for _, char := range str {
+		if idx == 0 {
+			return &object.String{Value: string(char)}
+		}
+		idx -= 1
+	}
+	return NULL
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
@@ -374,7 +924,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newCodedError(diagnostic.UNUSABLE_HASH_KEY, "unusable as hash key: %s", key.Type())
 		}
 
 		value := Eval(valueNode, env)
@@ -393,7 +943,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newCodedError(diagnostic.UNUSABLE_HASH_KEY, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
@@ -403,3 +953,153 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	return pair.Value
 }
+
+// Applies a prefix operator to an already evaluated operand. Shared with the
+// virtual machine so that both engines agree on operator semantics.
+func EvalPrefix(oper string, right object.Object) object.Object {
+	return evalPrefixExpression(oper, right)
+}
+
+// Applies an infix operator to already evaluated operands
+func EvalInfix(oper string, left, right object.Object) object.Object {
+	return evalInfixExpression(oper, left, right)
+}
+
+// Indexes an already evaluated array or hash
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// Joins the values of the parts of a string with embedded expressions
+func Interpolate(parts []object.Object) object.Object {
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(part.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
+// Reports whether obj counts as true in a condition
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Stores value at index of the array or hash left, for index assignments
+func SetIndex(left, index, value object.Object) object.Object {
+	return setIndex(left, index, value)
+}
+
+// Returns an iterator over iterable for a for-in loop, or an error if it
+// cannot be iterated over
+func Iterate(iterable object.Object) object.Object {
+	it, err := newIterator(iterable)
+	if err != nil {
+		return err
+	}
+	return it
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalIdentifierAssignment(node, target, env)
+	case *ast.IndexExpression:
+		return evalIndexAssignment(node, target, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// Combines the current value of an assignment target with the assigned
+// value for compound operators such as +=
+func evalCompoundValue(oper string, current, value object.Object) object.Object {
+	if oper == "=" {
+		return value
+	}
+	return evalInfixExpression(oper[:len(oper)-1], current, value)
+}
+
+func evalIdentifierAssignment(node *ast.AssignExpression, target *ast.Identifier, env *object.Environment) object.Object {
+	current, ok := env.Get(target.Value)
+	if !ok {
+		return newCodedError(diagnostic.UNDECLARED_VARIABLE,
+			"assignment to undeclared variable: %s", target.Value)
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	value = evalCompoundValue(node.Operator, current, value)
+	if isError(value) {
+		return value
+	}
+
+	env.Assign(target.Value, value)
+
+	return value
+}
+
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	if node.Operator != "=" {
+		current := evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+		value = evalCompoundValue(node.Operator, current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	return setIndex(left, index, value)
+}
+
+// Stores value at index of the array or hash left, returning value
+func setIndex(left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if _, ok := index.(*object.BigInteger); ok {
+			return newCodedError(diagnostic.INDEX_OUT_OF_RANGE,
+				"index out of range: %s", index.Inspect())
+		}
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newCodedError(diagnostic.INDEX_NOT_SUPPORTED,
+				"array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newCodedError(diagnostic.INDEX_OUT_OF_RANGE,
+				"index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newCodedError(diagnostic.UNUSABLE_HASH_KEY, "unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+
+	default:
+		return newCodedError(diagnostic.INDEX_NOT_SUPPORTED,
+			"index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
@@ -1,8 +1,12 @@
 package evaluator
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
@@ -17,6 +21,8 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"10", 10},
 		{"-5", -5},
 		{"-10", -10},
+		{"0xFF + 0o10 + 0b11", 266},
+		{"1_000_000 / 1_000", 1000},
 		{"5 + 5 + 5 + 5 - 10", 10},
 		{"2 * 2 * 2 * 2 * 2", 32},
 		{"-50 + 100 + -50", 0},
@@ -28,6 +34,26 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 7 % 4 * 2", 8},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 10", 1024},
+		{"1024 >> 3", 128},
+		{"-16 >> 2", -4},
+		{"-1 >> 100", -1},
+		{"5 >> 100", 0},
+		{"1 << 2 + 1", 8},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"10 ** 0", 1},
+		{"(1 << 62) >> 60", 4},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -81,6 +107,19 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"1.5 <= 1", false},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"abc" > "abd"`, false},
+		{`"b" >= "abc"`, true},
+		{`"" <= ""`, true},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -120,6 +159,32 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false || true && false", false},
+		{"let x = 0; false && (x = 1); x == 0", true},
+		{"let x = 0; true || (x = 1); x == 0", true},
+		{"let x = 0; true && (x = 1); x == 1", true},
+		{"false && undefinedName", false},
+		{"true || 1 / 0", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -219,6 +284,82 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"10 / 0",
+			"division by zero: 10 / 0",
+		},
+		{
+			"(9223372036854775807 + 1) / 0",
+			"division by zero: 9223372036854775808 / 0",
+		},
+		{
+			"1.5 / 0.0",
+			"division by zero: 1.5 / 0.0",
+		},
+		{
+			"1 / 0.0",
+			"division by zero: 1 / 0.0",
+		},
+		{
+			"let x = 0; 10 % x",
+			"division by zero: 10 % 0",
+		},
+		{
+			"0 ** -1",
+			"division by zero: 0 ** -1",
+		},
+		{
+			"1 << -1",
+			"negative shift amount: -1",
+		},
+		{
+			"1 << 10000000",
+			"integer too large: 1 << 10000000",
+		},
+		{
+			"10 ** 10000000",
+			"integer too large: 10 ** 10000000",
+		},
+		{
+			"1 << 9223372036854775807",
+			"integer too large: 1 << 9223372036854775807",
+		},
+		{
+			"1024 ** 4611686018427387904",
+			"integer too large: 1024 ** 4611686018427387904",
+		},
+		{
+			"(-3) ** 9223372036854775807",
+			"integer too large: -3 ** 9223372036854775807",
+		},
+		{
+			"1.5 & 1",
+			"unknown operator: FLOAT & INTEGER",
+		},
+		{
+			"~1.5",
+			"unknown operator: ~FLOAT",
+		},
+		{
+			"true | false",
+			"unknown operator: BOOLEAN | BOOLEAN",
+		},
+		{
+			"let add = fn(a, b) { a + b }; add(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"fn() { 1 }(1, 2)",
+			"wrong number of arguments: want=0, got=2",
+		},
+		{
+			`[1, 2, 3]["1"]`,
+			"array index must be INTEGER, got STRING",
+		},
+		{
+			"[1, 2, 3][1.0]",
+			"array index must be INTEGER, got FLOAT",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -235,6 +376,33 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"foobar", 1, 1},
+		{"let a = 5;\nlet b = a + true;", 2, 11},
+		{"let f = fn(x) {\n  x - \"a\"\n};\nf(1);", 2, 5},
+		{"len(1, 2)", 1, 4},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn,
+				errObj.Pos.Line, errObj.Pos.Column)
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -299,6 +467,65 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"tab\there"`, "tab\there"},
+		{`"quote: \"" + "\u{263A}"`, "quote: \"\u263A"},
+		{"`raw ${x} \\n`", "raw ${x} \\n"},
+		{"`two\nlines`", "two\nlines"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: String has wrong value. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Monkey"; let age = 9; "Hello ${name}, you are ${age + 1}"`, "Hello Monkey, you are 10"},
+		{`"${1}${2}"`, "12"},
+		{`"${[1, "two", 3.5]} ${true} ${if (false) { 1 }}"`, "[1, two, 3.5] true null"},
+		{`let h = {"key": "value"}; "got ${h["key"]}"`, "got value"},
+		{`"outer ${"inner ${1 + 1}"}"`, "outer inner 2"},
+		{`"${fn(x) { let y = {"a": x}; y["a"] }(4)}"`, "4"},
+		{`"cost: \${price}"`, "cost: ${price}"},
+		{`"just $ and {braces}"`, "just $ and {braces}"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: String has wrong value. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"value: ${missing}"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "identifier not found: missing" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	evaluated := testEval(input)
@@ -321,6 +548,10 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len(push([], 1))`, 1},
+		{`push([1, 2], 3)[0]`, 1},
+		{`push([1, 2], 3)[2]`, 3},
+		{`let a = [1]; push(a, 2); len(a)`, 1},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -342,6 +573,54 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`bytelen("日本語")`, 9},
+		{`bytes("aé")`, "[97, 195, 169]"},
+		{`"日本語"[1]`, "本"},
+		{`"héllo"[4]`, "o"},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-1]`, nil},
+		{`"abc"[9223372036854775807 + 1]`, nil},
+		{`"abc"["0"]`, "string index must be INTEGER, got STRING"},
+		{`slice("größer", 1, 4)`, "röß"},
+		{`slice("größer", 3)`, "ßer"},
+		{`slice("abc", 3)`, ""},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice("abc", 2, 1)`, "slice bounds out of range: [2:1] with length 3"},
+		{`slice("日本", 0, 3)`, "slice bounds out of range: [0:3] with length 2"},
+		{`slice("abc", "1")`, "bounds of `slice` must be INTEGER, got STRING"},
+		{`slice(1, 0)`, "argument to `slice` not supported, got INTEGER"},
+		{`bytes(1)`, "argument to `bytes` must be STRING, got INTEGER"},
+		{`let s = ""; for (c in "añb") { let s = c + s; }; s`, "bña"},
+		{`let größe = 3; let _x1 = größe * 2; _x1`, 6},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+				}
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q: wrong value. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -483,6 +762,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{1: 5}[1.5]`,
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -494,3 +785,416 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; let f = fn(x) { x + 1 }; while (false) { 1 }; 5", 5},
+		{"let count = fn(n) { let i = 0; let acc = 0; while (i < n) { let acc = acc + i; let i = i + 1; }; acc }; count(5)", 10},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i; } } }; f()", 3},
+		{"let i = 0; while (true) { let i = i + 1; if (i > 4) { break; } }; i", 5},
+		{"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + 1; }; n", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { let sum = sum + i; }; sum", 3},
+		{"let sum = 0; for (x in range(5)) { let sum = sum + x; }; sum", 10},
+		{"let sum = 0; for (x in range(2, 10, 3)) { let sum = sum + x; }; sum", 15},
+		{"let sum = 0; for (x in range(3, 0, -1)) { let sum = sum + x; }; sum", 6},
+		{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+		{`let s = ""; for (k in {"b": 2, "a": 1}) { let s = s + k; }; s`, "ab"},
+		{`let sum = 0; for (k, v in {"a": 1, "b": 2}) { let sum = sum + v; }; sum`, 3},
+		{"let last = 0; for (x in range(100)) { if (x == 7) { break; } let last = x; }; last", 6},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } let sum = sum + x; }; sum", 8},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()", 20},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"range(1, 2, 0)", "step of `range` must not be zero"},
+		{"len(range(0, 10, 3))", 4},
+		{"len(range(-9223372036854775807, 9223372036854775807, 2))", 9223372036854775807},
+		{"len(range(9223372036854775807, -9223372036854775807, -9223372036854775807))", 2},
+		{"let last = 0; for (x in range(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807)) { let last = x; }; last", 9223372036854775806},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let x = 10; x %= 4; x", 2},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 2 }; f(); x", 1},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let i = 0; while (i < 5) { i += 1; }; i", 5},
+		{"let a = [1, 2, 3]; a[0] = 10; a[0] + a[1]", 12},
+		{"let a = [1, 2, 3]; a[2] *= 3; a[2]", 9},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; h["a"] += 41; h["a"]`, 42},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] = 7; m[1][0]", 7},
+		{"y = 5", "assignment to undeclared variable: y"},
+		{"y += 5", "assignment to undeclared variable: y"},
+		{"let a = [1]; a[3] = 1", "index out of range: 3"},
+		{`let a = [1]; a["x"] = 1`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn() {}] = 1", "unusable as hash key: FUNCTION"},
+		{"let x = 1; x = x + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 10; x %= 0", "division by zero: 10 % 0"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1.5e-3 * 2", 0.003},
+		{"1e3 + 0.5", 1000.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"3 * 1.5 - 0.5", 4},
+		{"let x = 1; x += 0.25; x", 1.25},
+		{"(1 + 2 + 3) / 3.0", 2},
+		{"7.5 % 2", 1.5},
+		{"2 ** -1", 0.5},
+		{"4 ** 0.5", 2},
+		{"2.0 ** 3", 8},
+	}
+	for _, tt := range tests {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+
+	booleans := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 2.5", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.1 + 0.2 == 0.3", false},
+	}
+	for _, tt := range booleans {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{`int("42")`, 42},
+		{"int(true)", 1},
+		{"float(3)", 3.0},
+		{`float("2.5")`, 2.5},
+		{"round(2.5)", 3},
+		{"round(-2.4)", -2},
+		{"round(3.14159, 2)", 3.14},
+		{"floor(2.7)", 2},
+		{"floor(-2.2)", -3},
+		{"ceil(2.2)", 3},
+		{"ceil(5)", 5},
+		{`int("abc")`, "could not convert \"abc\" to INTEGER"},
+		{`int(float("NaN"))`, "result of `int` out of INTEGER range: NaN"},
+		{"floor([])", "argument to `floor` must be a number, got ARRAY"},
+		{"float(1, 2)", "wrong number of arguments. got=2, want=1"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestIntegerOverflowPromotion(t *testing.T) {
+	factorial := "let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; "
+	tests := []struct {
+		input    string
+		expected string
+		big      bool
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", true},
+		{"-9223372036854775807 - 2", "-9223372036854775809", true},
+		{"4294967296 * 4294967296", "18446744073709551616", true},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807", false},
+		{"(4294967296 * 4294967296) / 4294967296", "4294967296", false},
+		{"let min = -9223372036854775807 - 1; -min", "9223372036854775808", true},
+		{"let min = -9223372036854775807 - 1; min / -1", "9223372036854775808", true},
+		{"let min = -9223372036854775807 - 1; min * -1", "9223372036854775808", true},
+		{"let min = -9223372036854775807 - 1; -1 * min", "9223372036854775808", true},
+		{factorial + "fact(25)", "15511210043330985984000000", true},
+		{factorial + "fact(25) / fact(23)", "600", false},
+		{factorial + "-fact(21)", "-51090942171709440000", true},
+		{"let x = 9223372036854775807; x += 10; x", "9223372036854775817", true},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890", true},
+		{"int(100000000000000000000.0)", "100000000000000000000", true},
+		{"round(4294967296 * 4294967296)", "18446744073709551616", true},
+		{"2 ** 100", "1267650600228229401496703205376", true},
+		{"1 << 64", "18446744073709551616", true},
+		{"(1 << 64) >> 60", "16", false},
+		{"(1 << 64) | 1", "18446744073709551617", true},
+		{"((1 << 64) + 5) & 7", "5", false},
+		{"~(1 << 64)", "-18446744073709551617", true},
+		{"(2 ** 70) % 1000", "424", false},
+		{"1 ** 100000000000", "1", false},
+		{"(-1) ** 100000000001", "-1", false},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("%q: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Type() != object.INTEGER_OBJ {
+			t.Errorf("%q: object is not INTEGER. got=%s", tt.input, evaluated.Type())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong value. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if _, isBig := evaluated.(*object.BigInteger); isBig != tt.big {
+			t.Errorf("%q: wrong representation. expected big=%t, got=%T", tt.input, tt.big, evaluated)
+		}
+	}
+}
+
+func TestBigIntegerComparisonAndHashing(t *testing.T) {
+	big := "let big = 9223372036854775807 * 4; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{big + "big > 9223372036854775807", true},
+		{big + "big < 1", false},
+		{big + "big == 9223372036854775807 * 4", true},
+		{big + "big != big + 1", true},
+		{big + "big == 9223372036854775807", false},
+		{big + "big > 1.5", true},
+		{big + "let h = {}; h[big] = 1; h[9223372036854775807 * 2 * 2]", 1},
+		{big + "let h = {big: 1, 5: 2}; h[big - big + 5]", 2},
+		{big + "[1, 2, 3][big]", nil},
+		{big + "let a = [1]; a[big] = 2", "index out of range: 36893488147419103228"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEvaluationLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		host     func() *object.Host
+		expected string
+	}{
+		{
+			"while (true) {}",
+			func() *object.Host { return &object.Host{MaxSteps: 1000} },
+			diagnostic.STEP_LIMIT_EXCEEDED,
+		},
+		{
+			"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100000)",
+			func() *object.Host { return &object.Host{MaxSteps: 5000} },
+			diagnostic.STEP_LIMIT_EXCEEDED,
+		},
+		{
+			"let x = 0; while (true) { x += 1 }",
+			func() *object.Host {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return &object.Host{Context: ctx}
+			},
+			diagnostic.CANCELED,
+		},
+		{
+			"for (x in range(1000000000)) {}",
+			func() *object.Host {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				t.Cleanup(cancel)
+				return &object.Host{Context: ctx}
+			},
+			diagnostic.CANCELED,
+		},
+	}
+	for _, tt := range tests {
+		program := parser.NewParser(lexer.NewLexer([]byte(tt.input))).ParseProgram()
+		env := object.NewEnvironment()
+		env.SetHost(tt.host())
+		evaluated := Eval(program, env)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Code != tt.expected {
+			t.Errorf("%q: wrong error code. expected=%s, got=%s (%s)", tt.input, tt.expected, errObj.Code, errObj.Message)
+		}
+		if !errObj.Pos.IsValid() {
+			t.Errorf("%q: error has no position", tt.input)
+		}
+	}
+
+	env := object.NewEnvironment()
+	env.SetHost(&object.Host{MaxSteps: 1000})
+	program := parser.NewParser(lexer.NewLexer([]byte("let x = 0; while (x < 10) { x += 1 }; x"))).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 10)
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	input := `let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } };
+countdown(%d)`
+
+	env := object.NewEnvironment()
+	env.Host().MaxCallDepth = 50
+	program := parser.NewParser(lexer.NewLexer([]byte(fmt.Sprintf(input, 49)))).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 0)
+
+	program = parser.NewParser(lexer.NewLexer([]byte(fmt.Sprintf(input, 50)))).ParseProgram()
+	errObj, ok := Eval(program, env).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+	if errObj.Code != diagnostic.CALL_DEPTH_EXCEEDED {
+		t.Errorf("wrong error code. expected=%s, got=%s", diagnostic.CALL_DEPTH_EXCEEDED, errObj.Code)
+	}
+	if errObj.Message != "maximum recursion depth exceeded: more than 50 nested calls" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if errObj.Pos.Line != 1 || errObj.Pos.Column != 59 {
+		t.Errorf("wrong error position. expected=1:59, got=%d:%d", errObj.Pos.Line, errObj.Pos.Column)
+	}
+	expectedNotes := []string{
+		"in countdown called at 1:59",
+		"in countdown called at 1:59",
+		"in countdown called at 1:59",
+		"in countdown called at 1:59",
+		"in countdown called at 1:59",
+		"... and 45 calls before",
+	}
+	if fmt.Sprint(errObj.Notes) != fmt.Sprint(expectedNotes) {
+		t.Errorf("wrong notes. expected=%q, got=%q", expectedNotes, errObj.Notes)
+	}
+
+	// the calls that failed are no longer counted
+	program = parser.NewParser(lexer.NewLexer([]byte("countdown(49)"))).ParseProgram()
+	testIntegerObject(t, Eval(program, env), 0)
+
+	// the default depth stops infinite recursion before the Go stack runs out
+	evaluated := testEval("let f = fn(x) { fn() { f(x) }() }; f(1)")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Code != diagnostic.CALL_DEPTH_EXCEEDED || errObj.Notes[0] != "in fn called at 1:30" {
+		t.Errorf("wrong error. got=%s %q", errObj.Inspect(), errObj.Notes)
+	}
+}
@@ -0,0 +1,208 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+)
+
+// Runs scripts for a Go program. Globals set by one script or by the host
+// stay bound for the scripts run after it. An interpreter must not be used
+// by several goroutines at once.
+type Interpreter struct {
+	env  *object.Environment
+	host *object.Host
+	// name of the scripts in positions, empty if they have none
+	filename string
+}
+
+// Configures an interpreter
+type Option func(*Interpreter)
+
+// Sends the output of scripts, such as that of print, to w
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) { i.host.Stdout = w }
+}
+
+// Sends the error output of scripts, such as that of eprint, to w
+func WithStderr(w io.Writer) Option {
+	return func(i *Interpreter) { i.host.Stderr = w }
+}
+
+// Gives scripts r to read input from, as with input
+func WithStdin(r io.Reader) Option {
+	return func(i *Interpreter) { i.host.Stdin = r }
+}
+
+// Names the scripts run in positions reported in errors
+func WithFilename(name string) Option {
+	return func(i *Interpreter) { i.filename = name }
+}
+
+// Stops each script with a runtime error once it has evaluated n syntax
+// nodes, so that scripts cannot run forever. The calls made with Call are
+// bounded the same way.
+func WithMaxSteps(n int) Option {
+	return func(i *Interpreter) { i.host.MaxSteps = n }
+}
+
+// Stops scripts with a runtime error once more than n function calls are
+// nested, instead of object.DefaultMaxCallDepth
+func WithMaxCallDepth(n int) Option {
+	return func(i *Interpreter) { i.host.MaxCallDepth = n }
+}
+
+// Creates new interpreter. Without options, scripts use the standard
+// streams of the process.
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{env: object.NewEnvironment(), host: &object.Host{}}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.env.SetHost(i.host)
+	return i
+}
+
+// Returned when a script cannot be parsed
+type SyntaxError struct {
+	Diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.String()
+	}
+	return "syntax error: " + strings.Join(messages, "; ")
+}
+
+// Returned when a script fails while it runs
+type RuntimeError struct {
+	Err *object.Error
+	// error of the context that stopped the script, nil if it failed on its
+	// own
+	cause error
+}
+
+func (e *RuntimeError) Error() string {
+	return "runtime error: " + e.Diagnostic().String()
+}
+
+// Returns the error of the context that stopped the script, such as
+// context.DeadlineExceeded, nil if it failed on its own
+func (e *RuntimeError) Unwrap() error {
+	return e.cause
+}
+
+// Returns the error as a diagnostic for rendering
+func (e *RuntimeError) Diagnostic() *diagnostic.Diagnostic {
+	return e.Err.Diagnostic()
+}
+
+// Parses and runs source, returning the value of its last statement, or nil
+// if that has none. Fails with a *SyntaxError or a *RuntimeError, or with
+// the error of ctx if it is done before the script is run. A script still
+// running when ctx is done is stopped with a *RuntimeError wrapping the
+// error of ctx.
+func (i *Interpreter) Run(ctx context.Context, source string) (object.Object, error) {
+	p := parser.NewParser(lexer.NewFileLexer(i.filename, []byte(source)))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return nil, &SyntaxError{Diagnostics: p.Diagnostics()}
+	}
+
+	return i.eval(ctx, func() object.Object {
+		return evaluator.Eval(program, i.env)
+	})
+}
+
+// Calls the function bound to the global name, or the builtin function of
+// that name, with args
+func (i *Interpreter) Call(name string, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// Calls a function like Call, stopping once ctx is canceled or its deadline
+// passes as Run does
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	fn, ok := i.env.Get(name)
+	if !ok {
+		builtin, ok := evaluator.LookupBuiltin(name)
+		if !ok {
+			return nil, fmt.Errorf("no global named %s", name)
+		}
+		fn = builtin
+	}
+	if _, ok := fn.(*object.Function); !ok {
+		if _, ok := fn.(*object.Builtin); !ok {
+			return nil, fmt.Errorf("global %s is not a function: %s", name, fn.Type())
+		}
+	}
+
+	return i.eval(ctx, func() object.Object {
+		return evaluator.ApplyFunction(name, fn, args, i.host)
+	})
+}
+
+// Runs evaluate with a fresh step budget, stopping once ctx is done, and
+// converts its result
+func (i *Interpreter) eval(ctx context.Context, evaluate func() object.Object) (obj object.Object, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	i.host.Context = ctx
+	i.host.Steps = 0
+	// functions of the script called later on must not see a stale context
+	defer func() { i.host.Context = nil }()
+	defer func() {
+		if r := recover(); r != nil {
+			obj, err = result(evaluator.InternalError(r))
+		}
+	}()
+
+	obj, err = result(evaluate())
+	if err, ok := err.(*RuntimeError); ok && err.Err.Code == diagnostic.CANCELED {
+		err.cause = ctx.Err()
+	}
+	return obj, err
+}
+
+// Binds the Go function fn to the global name, for scripts to call it.
+// Arguments and results are converted between objects and the Go types of
+// its signature, and an error it returns becomes a runtime error of the
+// script. Fails if fn is not a function or returns more than a value and an
+// error.
+func (i *Interpreter) Register(name string, fn any) error {
+	builtin, err := object.NewGoBuiltin(name, fn)
+	if err != nil {
+		return err
+	}
+	i.env.Set(name, builtin)
+	return nil
+}
+
+// Binds value to the global name
+func (i *Interpreter) Set(name string, value object.Object) {
+	i.env.Set(name, value)
+}
+
+// Returns the value bound to the global name
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	return i.env.Get(name)
+}
+
+// Turns an error object from the evaluator into a Go error
+func result(obj object.Object) (object.Object, error) {
+	if errObj, ok := obj.(*object.Error); ok {
+		return nil, &RuntimeError{Err: errObj}
+	}
+	return obj, nil
+}
@@ -0,0 +1,388 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"interpreter/diagnostic"
+	"interpreter/object"
+)
+
+func TestRun(t *testing.T) {
+	i := New()
+
+	result, err := i.Run(context.Background(), "let double = fn(x) { x * 2 }; double(21)")
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if integer, ok := result.(*object.Integer); !ok || integer.Value != 42 {
+		t.Errorf("wrong result. got=%T (%+v)", result, result)
+	}
+
+	// globals stay bound between runs
+	result, err = i.Run(context.Background(), "double(4)")
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if result.Inspect() != "8" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	result, err = i.Run(context.Background(), "let x = 1;")
+	if err != nil || result != nil {
+		t.Errorf("expected no value and no error. got=%v, %v", result, err)
+	}
+
+	// no value converts like null
+	var v any = 1
+	if err := object.ToGo(result, &v); err != nil || v != nil {
+		t.Errorf("no value not converted to nil. got=%v, %v", v, err)
+	}
+	var n int
+	if err := object.ToGo(result, &n); err == nil {
+		t.Errorf("no value converted to int. got=%d", n)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	i := New(WithFilename("script.monkey"))
+
+	_, err := i.Run(context.Background(), "let = 5;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected *SyntaxError. got=%T (%v)", err, err)
+	}
+	if len(syntaxErr.Diagnostics) == 0 {
+		t.Errorf("syntax error has no diagnostics")
+	}
+	if !strings.HasPrefix(err.Error(), "syntax error: script.monkey:1:5: ") {
+		t.Errorf("wrong message. got=%q", err.Error())
+	}
+
+	_, err = i.Run(context.Background(), "1 + true")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error object. got=%q", runtimeErr.Err.Message)
+	}
+	if err.Error() != "runtime error: script.monkey:1:3: type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong message. got=%q", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := i.Run(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+}
+
+func TestCallSetAndGet(t *testing.T) {
+	i := New()
+	i.Set("greeting", &object.String{Value: "Hello"})
+
+	if _, err := i.Run(context.Background(), `let greet = fn(name) { greeting + ", " + name }; let n = 3;`); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	result, err := i.Call("greet", &object.String{Value: "Monkey"})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if result.Inspect() != "Hello, Monkey" {
+		t.Errorf("wrong result. got=%q", result.Inspect())
+	}
+
+	result, err = i.Call("len", &object.String{Value: "four"})
+	if err != nil || result.Inspect() != "4" {
+		t.Errorf("wrong result of builtin. got=%v, %v", result, err)
+	}
+
+	if n, ok := i.Get("n"); !ok || n.Inspect() != "3" {
+		t.Errorf("wrong global n. got=%v, %t", n, ok)
+	}
+	if _, ok := i.Get("missing"); ok {
+		t.Errorf("unbound global reported as bound")
+	}
+
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"missing", nil, "no global named missing"},
+		{"n", nil, "global n is not a function: INTEGER"},
+		{"greet", nil, "runtime error: wrong number of arguments: want=1, got=0"},
+	}
+	for _, tt := range tests {
+		_, err := i.Call(tt.name, tt.args...)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. expected=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	var stdout, stderr strings.Builder
+	i := New(
+		WithStdout(&stdout),
+		WithStderr(&stderr),
+		WithStdin(strings.NewReader("Ada\r\nLovelace\n")),
+	)
+
+	source := `
+let first = input("first name: ");
+let last = input();
+print("Hello " + first + " " + last);
+eprint("done");
+input()
+`
+	result, err := i.Run(context.Background(), source)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if result.Type() != object.NULL_OBJ {
+		t.Errorf("input at the end of input is not NULL. got=%s", result.Inspect())
+	}
+	if stdout.String() != "first name: Hello Ada Lovelace\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if stderr.String() != "done\n" {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+
+	// functions print to the streams of the interpreter they run in
+	stdout.Reset()
+	if _, err := i.Run(context.Background(), `let say = fn(x) { print(x) };`); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if _, err := i.Call("say", &object.Integer{Value: 7}); err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if stdout.String() != "7\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	i := New()
+
+	funcs := map[string]any{
+		"repeat": strings.Repeat,
+		"contains": func(s string, n int) (bool, error) {
+			if n < 0 {
+				return false, errors.New("negative count")
+			}
+			return strings.Count(s, "a") >= n, nil
+		},
+		"sum": func(xs ...float64) float64 {
+			total := 0.0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		},
+		"keys": func(m map[string]int) []string {
+			keys := []string{}
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		},
+		"counts": func(words []string) map[string]int {
+			counts := map[string]int{}
+			for _, w := range words {
+				counts[w]++
+			}
+			return counts
+		},
+		"describe": func(v any) string { return fmt.Sprintf("%T %v", v, v) },
+		"fail":     func() error { return errors.New("it failed") },
+		"noop":     func() {},
+		"byte":     func(b uint8) uint8 { return b },
+		"big":      func() uint64 { return math.MaxUint64 },
+		"explode":  func() int { panic("boom") },
+		"identity": func(o object.Object) object.Object { return o },
+	}
+	for name, fn := range funcs {
+		if err := i.Register(name, fn); err != nil {
+			t.Fatalf("Register(%s) failed: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{`contains("banana", 3)`, "true"},
+		{`contains("banana", -1)`, "ERROR: 1:9: negative count"},
+		{`sum()`, "0.0"},
+		{`sum(1, 2.5, 3)`, "6.5"},
+		{`keys({"b": 1, "a": 2})`, "[a, b]"},
+		{`counts(["x", "y", "x"])["x"]`, "2"},
+		{`describe([1, "two", 3.5, true, {"k": if (false) { 1 }}])`, "[]interface {} [1 two 3.5 true map[k:<nil>]]"},
+		{`describe(2 ** 70)`, "*big.Int 1180591620717411303424"},
+		{`fail()`, "ERROR: 1:5: it failed"},
+		{`noop()`, "null"},
+		{`byte(255)`, "255"},
+		{`byte(256)`, "ERROR: 1:5: argument 1 to `byte`: 256 out of range of uint8"},
+		{`big()`, "18446744073709551615"},
+		{`repeat("ab")`, "ERROR: 1:7: wrong number of arguments: want=2, got=1"},
+		{`repeat(1, 2)`, "ERROR: 1:7: argument 1 to `repeat`: cannot convert INTEGER to string"},
+		{`keys({"a": "b"})`, "ERROR: 1:5: argument 1 to `keys`: value of a: cannot convert STRING to int"},
+		{`explode()`, "ERROR: 1:8: panic in `explode`: boom"},
+		{`identity(fn(x) { x })(7)`, "7"},
+	}
+	for _, tt := range tests {
+		result, err := i.Run(context.Background(), tt.input)
+		var runtimeErr *RuntimeError
+		if errors.As(err, &runtimeErr) {
+			result = runtimeErr.Err
+		} else if err != nil {
+			t.Fatalf("%q: Run failed: %s", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	bad := map[string]any{
+		"not a function":   42,
+		"too many results": func() (int, int) { return 1, 2 },
+		"second not error": func() (int, string) { return 1, "" },
+	}
+	for name, fn := range bad {
+		if err := i.Register("bad", fn); err == nil {
+			t.Errorf("%s: expected Register to fail", name)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	i := New(WithMaxSteps(10000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := i.Run(ctx, "let spin = fn() { while (true) {} }; spin()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Code != diagnostic.STEP_LIMIT_EXCEEDED {
+		t.Errorf("wrong code. expected=%s, got=%s", diagnostic.STEP_LIMIT_EXCEEDED, runtimeErr.Err.Code)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("step limit reported as deadline")
+	}
+
+	// each run and call gets a budget of its own
+	for n := 0; n < 3; n++ {
+		if _, err := i.Run(context.Background(), "let x = 0; while (x < 100) { x += 1 }"); err != nil {
+			t.Fatalf("run %d failed: %s", n, err)
+		}
+	}
+
+	i = New()
+	_, err = i.Run(ctx, "let spin = fn() { while (true) {} }; spin()")
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded. got=%v", err)
+	}
+	if !strings.HasSuffix(err.Error(), ": evaluation stopped: context deadline exceeded") {
+		t.Errorf("wrong message. got=%q", err.Error())
+	}
+
+	// the expired context of the run does not stop calls made afterwards
+	if _, err := i.Run(context.Background(), "let count = fn(n) { let x = 0; while (x < n) { x += 1 }; x }"); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	result, err := i.Call("count", &object.Integer{Value: 1000})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if result.Inspect() != "1000" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+
+	if _, err := i.Run(context.Background(), "let spin = fn() { while (true) {} };"); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	callCtx, callCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer callCancel()
+	_, err = i.CallContext(callCtx, "spin")
+	if !errors.As(err, &runtimeErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected *RuntimeError wrapping context.DeadlineExceeded. got=%T (%v)", err, err)
+	}
+	if _, err := i.CallContext(callCtx, "count", &object.Integer{Value: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("call with expired context not refused. got=%v", err)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	i := New()
+	i.Set("boom", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		panic("boom")
+	}})
+
+	_, err := i.Run(context.Background(), "let f = fn() { boom() }; f()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Code != diagnostic.INTERNAL_ERROR || runtimeErr.Err.Message != "internal error: boom" {
+		t.Errorf("wrong error. got=%s %q", runtimeErr.Err.Code, runtimeErr.Err.Message)
+	}
+	if _, err := i.Call("f"); !errors.As(err, &runtimeErr) || runtimeErr.Err.Code != diagnostic.INTERNAL_ERROR {
+		t.Errorf("expected internal error from Call. got=%v", err)
+	}
+
+	// the interpreter stays usable, without calls left over from the panic
+	result, err := i.Run(context.Background(), "push([], 1)")
+	if err != nil || result.Inspect() != "[1]" {
+		t.Errorf("wrong result. got=%v, %v", result, err)
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	i := New(WithMaxCallDepth(100))
+	_, err := i.Run(context.Background(), "let f = fn(n) { f(n + 1) }; f(0)")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+	if err.Error() != "runtime error: 1:18: maximum recursion depth exceeded: more than 100 nested calls" {
+		t.Errorf("wrong message. got=%q", err.Error())
+	}
+	if notes := runtimeErr.Diagnostic().Notes; len(notes) == 0 || notes[0] != "in f called at 1:18" {
+		t.Errorf("wrong notes. got=%q", notes)
+	}
+
+	// calls made by the host count toward the depth as well
+	i = New(WithMaxCallDepth(3))
+	if _, err := i.Run(context.Background(), "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };"); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if _, err := i.Call("f", &object.Integer{Value: 2}); err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	_, err = i.Call("f", &object.Integer{Value: 3})
+	if !errors.As(err, &runtimeErr) || runtimeErr.Err.Code != diagnostic.CALL_DEPTH_EXCEEDED {
+		t.Fatalf("expected call depth error. got=%v", err)
+	}
+	expected := []string{"in f called at 1:43", "in f called at 1:43", "in f called by the host"}
+	if notes := runtimeErr.Diagnostic().Notes; !reflect.DeepEqual(notes, expected) {
+		t.Errorf("wrong notes. expected=%q, got=%q", expected, notes)
+	}
+}
@@ -1,52 +1,327 @@
 package lexer
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
 
+	"interpreter/diagnostic"
 	t "interpreter/token"
 )
 
+// Number of bytes a streaming lexer makes room for when its buffer is full
+const readChunkSize = 64 * 1024
+
+// Smallest free space in the buffer a streaming lexer reads into
+const minReadSize = 512
+
 type Lexer struct {
+	// input read so far, from which consumed bytes are discarded when
+	// lexing from a reader
 	input        []byte
 	position     int
 	readPosition int
 	char         byte
+
+	// remaining input of a streaming lexer, nil once it is exhausted
+	reader io.Reader
+	// error that ended reading, reported with the EOF token
+	readErr error
+	// offset of input[0] in the whole source
+	base int
+	// start of the first byte of input still needed
+	mark int
+
+	filename  string
+	line      int
+	lineStart int // offset in the whole source
+	scanned   int
+
+	keepComments bool
+	comments     []Comment
+
+	// number of braces opened within each embedded expression being read,
+	// innermost last
+	interpolations []int
+
+	diagnostics []*diagnostic.Diagnostic
+}
+
+// Comment found in the input. Comments are not passed on as tokens, but can
+// be kept for tools that need to preserve them, such as formatters.
+type Comment struct {
+	Text  []byte // including the delimiters
+	Pos   t.Position
+	Block bool
 }
 
 // Creates new lexer
 func NewLexer(input []byte) *Lexer {
-	lexer := &Lexer{input: input}
+	lexer := &Lexer{input: input, line: 1}
+	return lexer
+}
+
+// Creates new lexer whose token positions refer to filename
+func NewFileLexer(filename string, input []byte) *Lexer {
+	lexer := NewLexer(input)
+	lexer.filename = filename
 	return lexer
 }
 
+// Creates new lexer reading its input from r as it is needed, so that the
+// whole input never has to be in memory. Token positions refer to
+// filename, which may be empty.
+func NewReaderLexer(filename string, r io.Reader) *Lexer {
+	lexer := NewFileLexer(filename, nil)
+	lexer.reader = r
+	return lexer
+}
+
+// Makes the lexer record the comments it skips, see Comments
+func (l *Lexer) KeepComments() {
+	l.keepComments = true
+}
+
+// Returns the comments read so far, in source order. Comments are only
+// recorded after KeepComments has been called.
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
+// Returns the errors found while reading the input
+func (l *Lexer) Diagnostics() []*diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+// Returns the source position of the given offset into input. Offsets must
+// not decrease between calls.
+func (l *Lexer) positionAt(offset int) t.Position {
+	for ; l.scanned < offset && l.scanned < len(l.input); l.scanned += 1 {
+		if l.input[l.scanned] == '\n' {
+			l.line += 1
+			l.lineStart = l.base + l.scanned + 1
+		}
+	}
+	return t.Position{
+		Filename: l.filename,
+		Line:     l.line,
+		Column:   l.base + offset - l.lineStart + 1,
+		Offset:   l.base + offset,
+	}
+}
+
+// Reports whether input[i] exists, reading more input if needed. Reading
+// may move the input, so callers must index relative to the lexer's fields.
+func (l *Lexer) has(i int) bool {
+	for i >= len(l.input) && l.reader != nil {
+		base := l.base
+		l.fill()
+		i -= l.base - base
+	}
+	return i < len(l.input)
+}
+
+// Reports whether the input at the read position starts with prefix
+func (l *Lexer) hasPrefix(prefix string) bool {
+	return l.has(l.readPosition+len(prefix)-1) && bytes.HasPrefix(l.input[l.readPosition:], []byte(prefix))
+}
+
+// Reads the next chunk from the reader. When the buffer is full, input
+// before the mark is dropped by moving the rest to a new buffer, so that
+// literals of earlier tokens stay valid.
+func (l *Lexer) fill() {
+	if cap(l.input)-len(l.input) < minReadSize {
+		// count the lines of the dropped input first
+		l.positionAt(l.mark)
+
+		rest := l.input[l.mark:]
+		input := make([]byte, len(rest), 2*len(rest)+readChunkSize)
+		copy(input, rest)
+
+		l.input = input
+		l.base += l.mark
+		l.position -= l.mark
+		l.readPosition -= l.mark
+		l.scanned -= l.mark
+		l.mark = 0
+	}
+
+	n, err := l.reader.Read(l.input[len(l.input):cap(l.input)])
+	l.input = l.input[:len(l.input)+n]
+	if err != nil {
+		l.reader = nil
+		if err != io.EOF {
+			l.readErr = err
+		}
+	}
+}
+
+// Records an error covering length bytes from pos
+func (l *Lexer) errorAt(code string, pos t.Position, length int, format string, a ...interface{}) *diagnostic.Diagnostic {
+	d := &diagnostic.Diagnostic{
+		Severity: diagnostic.ERROR,
+		Code:     code,
+		Span:     diagnostic.SpanOf(pos, length),
+		Message:  fmt.Sprintf(format, a...),
+	}
+	l.diagnostics = append(l.diagnostics, d)
+	return d
+}
+
 // Peeks at next character in input
 func (l *Lexer) PeekChar() byte {
-	if l.readPosition >= len(l.input) {
+	if !l.has(l.readPosition) {
 		return 0
 	}
 	return l.input[l.readPosition]
 }
 
+// Returns the character n bytes after the next one, or 0 past the end of
+// input
+func (l *Lexer) peekByte(n int) byte {
+	if !l.has(l.readPosition + n) {
+		return 0
+	}
+	return l.input[l.readPosition+n]
+}
+
 // Reads identifier from input
 func (l *Lexer) ReadIdentifier() []byte {
-	for ; l.readPosition < len(l.input) && isAlphabet(l.input[l.readPosition]); l.readPosition += 1 {
+	for l.has(l.readPosition) {
+		r, size := l.peekRune()
+		if !isLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		l.readPosition += size
 	}
 	return l.input[l.position:l.readPosition]
 }
 
-// Reads number from input
-func (l *Lexer) ReadNumber() []byte {
-	for ; l.readPosition < len(l.input) && isDigit(l.input[l.readPosition]); l.readPosition += 1 {
+// Reads number from input, returning its literal and whether it is an
+// integer or a float. Integers may be written in hexadecimal (0xFF), octal
+// (0o755) or binary (0b1010), floats may have an exponent (1.5e-3), and
+// digits may be separated by underscores (1_000_000).
+func (l *Lexer) ReadNumber() ([]byte, t.TokenType) {
+	if l.char == '0' {
+		if base, name := basePrefix(l.PeekChar()); base != 0 {
+			l.readPosition += 1
+			digits, reported := l.readDigits(base, name, true, false)
+			if digits == 0 && !reported {
+				l.errorAt(diagnostic.MALFORMED_NUMBER, l.positionAt(l.position), l.readPosition-l.position,
+					"%s literal has no digits", name)
+			}
+			return l.input[l.position:l.readPosition], t.INT
+		}
 	}
-	return l.input[l.position:l.readPosition]
+
+	tokenType := t.TokenType(t.INT)
+	_, reported := l.readDigits(10, "decimal", true, false)
+
+	// a fraction needs digits after the point, so 1.foo is not a float
+	if l.PeekChar() == '.' && isDigit(l.peekByte(1)) {
+		tokenType = t.FLOAT
+		l.readPosition += 1
+		_, reported = l.readDigits(10, "decimal", false, reported)
+	}
+
+	// an exponent needs digits too, so the e of 2else is left alone
+	if c := l.PeekChar(); c == 'e' || c == 'E' {
+		sign := l.peekByte(1)
+		hasSign := sign == '+' || sign == '-'
+		if isDigit(sign) || (hasSign && isDigit(l.peekByte(2))) {
+			tokenType = t.FLOAT
+			l.readPosition += 1
+			if hasSign {
+				l.readPosition += 1
+			}
+			l.readDigits(10, "decimal", false, reported)
+		}
+	}
+
+	return l.input[l.position:l.readPosition], tokenType
 }
 
-// Checks if byte is an alphabet
-func isAlphabet(c byte) bool {
-	if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
-		return true
+// Returns the base and its name for the character following a leading 0 of
+// a number, or 0 if it is not a base prefix
+func basePrefix(c byte) (int, string) {
+	switch c {
+	case 'x', 'X':
+		return 16, "hexadecimal"
+	case 'o', 'O':
+		return 8, "octal"
+	case 'b', 'B':
+		return 2, "binary"
 	}
-	return false
+	return 0, ""
+}
+
+// Reads digits of a number in base, which may be separated by underscores,
+// and returns how many were read. leading tells whether an underscore may
+// come first. Only the first malformed part of a number is reported, so
+// reported tells whether it already has been, and is returned updated.
+func (l *Lexer) readDigits(base int, name string, leading bool, reported bool) (int, bool) {
+	digits := 0
+	underscore := -1
+	report := func(offset int, format string, a ...interface{}) {
+		if !reported {
+			l.errorAt(diagnostic.MALFORMED_NUMBER, l.positionAt(offset), 1, format, a...)
+			reported = true
+		}
+	}
+
+	for ; l.has(l.readPosition); l.readPosition += 1 {
+		c := l.input[l.readPosition]
+		switch {
+		case c == '_':
+			if underscore >= 0 || (digits == 0 && !leading) {
+				report(l.readPosition, "'_' must separate successive digits")
+			}
+			// kept relative to the number, as reading may move the input
+			underscore = l.readPosition - l.position
+			continue
+		case digitValue(c) < base:
+		case isDigit(c):
+			report(l.readPosition, "invalid digit '%c' in %s literal", c, name)
+		default:
+			if underscore >= 0 {
+				report(l.position+underscore, "'_' must separate successive digits")
+			}
+			return digits, reported
+		}
+		digits += 1
+		underscore = -1
+	}
+
+	if underscore >= 0 {
+		report(l.position+underscore, "'_' must separate successive digits")
+	}
+	return digits, reported
+}
+
+// Returns the value of a hexadecimal digit, or 16 for any other character
+func digitValue(c byte) int {
+	switch {
+	case isDigit(c):
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 16
+}
+
+// Checks if character can start an identifier
+func isLetter(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// Checks if byte is a hexadecimal digit
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
 }
 
 // Checks if byte is a digit
@@ -61,24 +336,23 @@ func isDigit(c byte) bool {
 func (l *Lexer) GetToken() t.Token {
 	var tok t.Token
 
-	if l.readPosition >= len(l.input) {
-		tok.Type = t.EOF
-		tok.Literal = []byte{0}
-		return tok
-	}
-
-	for ; l.readPosition < len(l.input) && l.input[l.readPosition] == ' '; l.readPosition += 1 {
-	}
+	l.skipTrivia()
 
-	if l.readPosition >= len(l.input) {
+	if !l.has(l.readPosition) {
 		tok.Type = t.EOF
 		tok.Literal = []byte{0}
+		tok.Pos = l.positionAt(len(l.input))
+		if l.readErr != nil {
+			l.errorAt(diagnostic.READ_FAILED, tok.Pos, 0, "could not read input: %s", l.readErr)
+			l.readErr = nil
+		}
 		return tok
 	}
 
 	l.position = l.readPosition
 	l.char = l.input[l.position]
 	l.readPosition += 1
+	tok.Pos = l.positionAt(l.position)
 
 	switch l.char {
 	case ';':
@@ -94,9 +368,21 @@ func (l *Lexer) GetToken() t.Token {
 		tok.Type = t.RPAREN
 		tok.Literal = []byte{')'}
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1] += 1
+		}
 		tok.Type = t.LBRACE
 		tok.Literal = []byte{'{'}
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			// the embedded expression ends and the string continues
+			tok.Literal, tok.Type = l.readStringSegment(true)
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1] -= 1
+		}
 		tok.Type = t.RBRACE
 		tok.Literal = []byte{'}'}
 	case '[':
@@ -106,20 +392,54 @@ func (l *Lexer) GetToken() t.Token {
 		tok.Type = t.RBRACKET
 		tok.Literal = []byte{']'}
 	case '+':
-		tok.Type = t.PLUS
-		tok.Literal = []byte{'+'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.PLUS_ASSIGN
+			tok.Literal = []byte{'+', '='}
+		} else {
+			tok.Type = t.PLUS
+			tok.Literal = []byte{'+'}
+		}
 	case '-':
-		tok.Type = t.MINUS
-		tok.Literal = []byte{'-'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.MINUS_ASSIGN
+			tok.Literal = []byte{'-', '='}
+		} else {
+			tok.Type = t.MINUS
+			tok.Literal = []byte{'-'}
+		}
 	case '*':
-		tok.Type = t.ASTERISK
-		tok.Literal = []byte{'*'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.ASTERISK_ASSIGN
+			tok.Literal = []byte{'*', '='}
+		} else if l.PeekChar() == '*' {
+			l.readPosition += 1
+			tok.Type = t.POWER
+			tok.Literal = []byte{'*', '*'}
+		} else {
+			tok.Type = t.ASTERISK
+			tok.Literal = []byte{'*'}
+		}
 	case '/':
-		tok.Type = t.SLASH
-		tok.Literal = []byte{'/'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.SLASH_ASSIGN
+			tok.Literal = []byte{'/', '='}
+		} else {
+			tok.Type = t.SLASH
+			tok.Literal = []byte{'/'}
+		}
 	case '%':
-		tok.Type = t.MODULO
-		tok.Literal = []byte{'%'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.MODULO_ASSIGN
+			tok.Literal = []byte{'%', '='}
+		} else {
+			tok.Type = t.MODULO
+			tok.Literal = []byte{'%'}
+		}
 	case '!':
 		if l.PeekChar() == '=' {
 			l.readPosition += 1
@@ -130,11 +450,55 @@ func (l *Lexer) GetToken() t.Token {
 			tok.Literal = []byte{'!'}
 		}
 	case '<':
-		tok.Type = t.LT
-		tok.Literal = []byte{'<'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.LT_EQ
+			tok.Literal = []byte{'<', '='}
+		} else if l.PeekChar() == '<' {
+			l.readPosition += 1
+			tok.Type = t.SHL
+			tok.Literal = []byte{'<', '<'}
+		} else {
+			tok.Type = t.LT
+			tok.Literal = []byte{'<'}
+		}
 	case '>':
-		tok.Type = t.GT
-		tok.Literal = []byte{'>'}
+		if l.PeekChar() == '=' {
+			l.readPosition += 1
+			tok.Type = t.GT_EQ
+			tok.Literal = []byte{'>', '='}
+		} else if l.PeekChar() == '>' {
+			l.readPosition += 1
+			tok.Type = t.SHR
+			tok.Literal = []byte{'>', '>'}
+		} else {
+			tok.Type = t.GT
+			tok.Literal = []byte{'>'}
+		}
+	case '&':
+		if l.PeekChar() == '&' {
+			l.readPosition += 1
+			tok.Type = t.AND
+			tok.Literal = []byte{'&', '&'}
+		} else {
+			tok.Type = t.BIT_AND
+			tok.Literal = []byte{'&'}
+		}
+	case '|':
+		if l.PeekChar() == '|' {
+			l.readPosition += 1
+			tok.Type = t.OR
+			tok.Literal = []byte{'|', '|'}
+		} else {
+			tok.Type = t.BIT_OR
+			tok.Literal = []byte{'|'}
+		}
+	case '^':
+		tok.Type = t.BIT_XOR
+		tok.Literal = []byte{'^'}
+	case '~':
+		tok.Type = t.BIT_NOT
+		tok.Literal = []byte{'~'}
 	case '=':
 		if l.PeekChar() == '=' {
 			l.readPosition += 1
@@ -145,28 +509,129 @@ func (l *Lexer) GetToken() t.Token {
 			tok.Literal = []byte{'='}
 		}
 	case '"':
+		tok.Literal, tok.Type = l.ReadString()
+	case '`':
 		tok.Type = t.STRING
-		tok.Literal = l.ReadString()
+		tok.Literal = l.ReadRawString()
 	case ':':
 		tok.Type = t.COLON
 		tok.Literal = []byte{':'}
-	case '\n':
-		tok = l.GetToken()
 	default:
-		if isAlphabet(l.char) {
+		// decode the character again, keeping a multi-byte one whole
+		l.readPosition = l.position
+		r, size := l.peekRune()
+		l.readPosition += size
+
+		if isLetter(r) {
 			tok.Literal = l.ReadIdentifier()
 			tok.Type = t.LookupIdentifier(string(tok.Literal))
 		} else if isDigit(l.char) {
-			tok.Literal = l.ReadNumber()
-			tok.Type = t.INT
+			tok.Literal, tok.Type = l.ReadNumber()
 		} else {
 			tok.Type = t.ILLEGAL
+			tok.Literal = l.input[l.position:l.readPosition]
 		}
 	}
 
 	return tok
 }
 
+// Skips whitespace, including line breaks, and comments before the next
+// token
+func (l *Lexer) skipTrivia() {
+	// a byte order mark may precede the input of files saved on Windows
+	if l.base+l.readPosition == 0 && l.hasPrefix("\uFEFF") {
+		l.readPosition += len("\uFEFF")
+	}
+
+	for {
+		l.mark = l.readPosition
+		if !l.has(l.readPosition) {
+			return
+		}
+
+		switch {
+		case l.spaceSize() > 0:
+			l.readPosition += l.spaceSize()
+		case l.hasPrefix("//"):
+			l.skipLineComment()
+		case l.hasPrefix("/*"):
+			l.skipBlockComment()
+		default:
+			return
+		}
+	}
+}
+
+// Returns the size of the whitespace character at the read position, or 0
+// if there is none. Any Unicode whitespace is accepted.
+func (l *Lexer) spaceSize() int {
+	r, size := l.peekRune()
+	if unicode.IsSpace(r) {
+		return size
+	}
+	return 0
+}
+
+// Returns the character at the read position and its size in bytes. Invalid
+// UTF-8 is returned as utf8.RuneError of size 1.
+func (l *Lexer) peekRune() (rune, int) {
+	c := l.input[l.readPosition]
+	if c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+
+	l.has(l.readPosition + utf8.UTFMax - 1)
+	return utf8.DecodeRune(l.input[l.readPosition:])
+}
+
+// Skips a comment running up to the end of the line. The comment starts at
+// the mark, which is kept in place while reading more input.
+func (l *Lexer) skipLineComment() {
+	for ; l.has(l.readPosition) && l.input[l.readPosition] != '\n'; l.readPosition += 1 {
+	}
+	l.addComment(false)
+}
+
+// Skips a block comment starting at the mark, which may contain nested
+// block comments
+func (l *Lexer) skipBlockComment() {
+	depth := 0
+	for l.has(l.readPosition) {
+		switch {
+		case l.hasPrefix("/*"):
+			depth += 1
+			l.readPosition += 2
+		case l.hasPrefix("*/"):
+			depth -= 1
+			l.readPosition += 2
+			if depth == 0 {
+				l.addComment(true)
+				return
+			}
+		default:
+			l.readPosition += 1
+		}
+	}
+
+	d := l.errorAt(diagnostic.UNTERMINATED_COMMENT, l.positionAt(l.mark), 2, "unterminated block comment")
+	d.Notes = append(d.Notes, "the comment runs to the end of the input")
+	l.addComment(true)
+}
+
+func (l *Lexer) addComment(block bool) {
+	if !l.keepComments {
+		return
+	}
+	// the carriage return of a CRLF line ending is not part of the comment
+	text := bytes.TrimSuffix(l.input[l.mark:l.readPosition], []byte("\r"))
+	l.comments = append(l.comments, Comment{
+		Text:  text,
+		Pos:   l.positionAt(l.mark),
+		Block: block,
+	})
+}
+
 // Returns slice of tokens from input
 func Tokenize(input []byte) []t.Token {
 	lexer := NewLexer(input)
@@ -185,11 +650,163 @@ func Tokenize(input []byte) []t.Token {
 	return tokens
 }
 
-func (l *Lexer) ReadString() []byte {
-	for ; l.readPosition < len(l.input) && l.input[l.readPosition] != '"'; l.readPosition += 1 {
+// Reads a string in double quotes, returning its value with escape
+// sequences replaced. A string with embedded expressions is returned as a
+// STRING_START token holding the text up to the first expression.
+func (l *Lexer) ReadString() ([]byte, t.TokenType) {
+	value, tokenType := l.readStringSegment(false)
+
+	switch tokenType {
+	case t.STRING_END:
+		return value, t.STRING
+	case t.STRING_MIDDLE:
+		return value, t.STRING_START
+	default:
+		return value, tokenType
+	}
+}
+
+// Reads the text of a string up to its closing quote or an embedded
+// expression. continued tells whether the text follows an embedded
+// expression rather than the opening quote. The string must end on the line
+// it starts on.
+func (l *Lexer) readStringSegment(continued bool) ([]byte, t.TokenType) {
+	start := l.positionAt(l.position)
+	value := []byte{}
+
+	for {
+		if !l.has(l.readPosition) || l.input[l.readPosition] == '\n' {
+			length := len(bytes.TrimRight(l.input[l.position:l.readPosition], "\r"))
+			d := l.errorAt(diagnostic.UNTERMINATED_STRING, start, length, "unterminated string literal")
+			d.Hints = append(d.Hints, "strings spanning several lines are written in backticks")
+			return value, l.endStringSegment(continued)
+		}
+
+		switch c := l.input[l.readPosition]; {
+		case c == '"':
+			l.readPosition += 1
+			return value, l.endStringSegment(continued)
+		case c == '$' && l.hasPrefix("${"):
+			l.readPosition += 2
+			if !continued {
+				l.interpolations = append(l.interpolations, 0)
+			}
+			return value, t.STRING_MIDDLE
+		case c == '\\':
+			value = l.readEscape(value)
+		default:
+			value = append(value, c)
+			l.readPosition += 1
+		}
+	}
+}
+
+// Finishes a string, leaving its embedded expressions if it had any
+func (l *Lexer) endStringSegment(continued bool) t.TokenType {
+	if continued {
+		l.interpolations = l.interpolations[:len(l.interpolations)-1]
+	}
+	return t.STRING_END
+}
+
+// Reads the escape sequence at the read position and appends the character
+// it stands for to value
+func (l *Lexer) readEscape(value []byte) []byte {
+	// kept relative to the string, as reading may move the input
+	start := l.readPosition - l.position
+	l.readPosition += 1
+	if !l.has(l.readPosition) || l.input[l.readPosition] == '\n' {
+		// reported as an unterminated string
+		return value
+	}
+
+	c := l.input[l.readPosition]
+	l.readPosition += 1
+
+	switch c {
+	case 'n':
+		return append(value, '\n')
+	case 't':
+		return append(value, '\t')
+	case 'r':
+		return append(value, '\r')
+	case '"':
+		return append(value, '"')
+	case '\\':
+		return append(value, '\\')
+	case '$':
+		return append(value, '$')
+	case 'u':
+		return l.readUnicodeEscape(value, start)
+	}
+
+	// a multi-byte character after the backslash is reported whole
+	if c >= utf8.RuneSelf {
+		l.has(l.position + start + utf8.UTFMax)
+		_, size := utf8.DecodeRune(l.input[l.position+start+1:])
+		l.readPosition = l.position + start + 1 + size
+	}
+	sequence := l.input[l.position+start : l.readPosition]
+	d := l.errorAt(diagnostic.INVALID_ESCAPE, l.positionAt(l.position+start), len(sequence), "invalid escape sequence %s", sequence)
+	d.Hints = append(d.Hints, `valid escapes are \n, \t, \r, \", \\, \$ and \u{...}`)
+	return value
+}
+
+// Reads the rest of a \u{...} escape starting at start, relative to the
+// string, holding a code point in hexadecimal
+func (l *Lexer) readUnicodeEscape(value []byte, start int) []byte {
+	if !l.has(l.readPosition) || l.input[l.readPosition] != '{' {
+		l.errorAt(diagnostic.INVALID_ESCAPE, l.positionAt(l.position+start), l.readPosition-l.position-start,
+			"invalid escape sequence \\u: expected a code point in braces, as in \\u{1F600}")
+		return value
+	}
+	l.readPosition += 1
+
+	digits := l.readPosition - l.position
+	for ; l.has(l.readPosition) && isHexDigit(l.input[l.readPosition]); l.readPosition += 1 {
+	}
+	hex := string(l.input[l.position+digits : l.readPosition])
+
+	closed := l.has(l.readPosition) && l.input[l.readPosition] == '}'
+	if closed {
+		l.readPosition += 1
+	}
+	sequence := l.input[l.position+start : l.readPosition]
+	if !closed || len(hex) == 0 || len(hex) > 6 {
+		l.errorAt(diagnostic.INVALID_ESCAPE, l.positionAt(l.position+start), len(sequence),
+			"invalid escape sequence %s: expected 1 to 6 hexadecimal digits and a closing brace", sequence)
+		return value
+	}
+
+	code, _ := strconv.ParseUint(hex, 16, 32)
+	r := rune(code)
+	if !utf8.ValidRune(r) {
+		l.errorAt(diagnostic.INVALID_ESCAPE, l.positionAt(l.position+start), len(sequence),
+			"invalid escape sequence %s: not a valid Unicode code point", sequence)
+		return value
+	}
+	return utf8.AppendRune(value, r)
+}
+
+// Reads a string in backticks, which may span several lines and contains
+// no escape sequences. Carriage returns are dropped, so that the value
+// does not depend on the line endings of the file.
+func (l *Lexer) ReadRawString() []byte {
+	start := l.positionAt(l.position)
+	value := []byte{}
+
+	for ; l.has(l.readPosition) && l.input[l.readPosition] != '`'; l.readPosition += 1 {
+		if c := l.input[l.readPosition]; c != '\r' {
+			value = append(value, c)
+		}
 	}
 
+	if !l.has(l.readPosition) {
+		d := l.errorAt(diagnostic.UNTERMINATED_STRING, start, 1, "unterminated raw string literal")
+		d.Notes = append(d.Notes, "the string runs to the end of the input")
+		return value
+	}
 	l.readPosition += 1
 
-	return l.input[l.position+1 : l.readPosition-1]
+	return value
 }
@@ -0,0 +1,582 @@
+package lexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"interpreter/token"
+)
+
+func TestTokenPositions(t *testing.T) {
+	input := "let five = 5;\nlet ten =\n  10;"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENTIFIER, 1, 5, 4},
+		{token.ASSIGN, 1, 10, 9},
+		{token.INT, 1, 12, 11},
+		{token.SEMICOLON, 1, 13, 12},
+		{token.LET, 2, 1, 14},
+		{token.IDENTIFIER, 2, 5, 18},
+		{token.ASSIGN, 2, 9, 22},
+		{token.INT, 3, 3, 26},
+		{token.SEMICOLON, 3, 5, 28},
+		{token.EOF, 3, 6, 29},
+	}
+
+	l := NewFileLexer("test.monkey", []byte(input))
+
+	for i, tt := range tests {
+		tok := l.GetToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Filename != "test.monkey" {
+			t.Errorf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - offset wrong. expected=%d, got=%d",
+				i, tt.expectedOffset, tok.Pos.Offset)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := "% <= >= < > && || & | ^ ~ << >> ** * *="
+
+	tests := []token.TokenType{
+		token.MODULO,
+		token.LT_EQ,
+		token.GT_EQ,
+		token.LT,
+		token.GT,
+		token.AND,
+		token.OR,
+		token.BIT_AND,
+		token.BIT_OR,
+		token.BIT_XOR,
+		token.BIT_NOT,
+		token.SHL,
+		token.SHR,
+		token.POWER,
+		token.ASTERISK,
+		token.ASTERISK_ASSIGN,
+		token.EOF,
+	}
+
+	l := NewLexer([]byte(input))
+
+	for i, expectedType := range tests {
+		tok := l.GetToken()
+		if tok.Type != expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, expectedType, tok.Type)
+		}
+		if expectedType != token.EOF && string(tok.Literal) != string(expectedType) {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, expectedType, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := "5 3.14 10.0 7.foo"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "10.0"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENTIFIER, "foo"},
+		{token.EOF, "\x00"},
+	}
+
+	l := NewLexer([]byte(input))
+
+	for i, tt := range tests {
+		tok := l.GetToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if string(tok.Literal) != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumberForms(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{"0xFF", token.INT, "0xFF", ""},
+		{"0o755", token.INT, "0o755", ""},
+		{"0B1010", token.INT, "0B1010", ""},
+		{"1_000_000", token.INT, "1_000_000", ""},
+		{"0x_FF", token.INT, "0x_FF", ""},
+		{"1.5e-3", token.FLOAT, "1.5e-3", ""},
+		{"1e+10", token.FLOAT, "1e+10", ""},
+		{"2E5", token.FLOAT, "2E5", ""},
+		{"1_0.2_5e1_0", token.FLOAT, "1_0.2_5e1_0", ""},
+		{"2else", token.INT, "2", ""},
+		{"3e+x", token.INT, "3", ""},
+		{"0x", token.INT, "0x", "1:1: hexadecimal literal has no digits"},
+		{"0b", token.INT, "0b", "1:1: binary literal has no digits"},
+		{"0b1021", token.INT, "0b1021", "1:5: invalid digit '2' in binary literal"},
+		{"0o78", token.INT, "0o78", "1:4: invalid digit '8' in octal literal"},
+		{"1__0", token.INT, "1__0", "1:3: '_' must separate successive digits"},
+		{"10_", token.INT, "10_", "1:3: '_' must separate successive digits"},
+		{"1_.5", token.FLOAT, "1_.5", "1:2: '_' must separate successive digits"},
+		{"1._5", token.INT, "1", ""},
+		{"1.5_e3", token.FLOAT, "1.5_e3", "1:4: '_' must separate successive digits"},
+		{"1e_3", token.INT, "1", ""},
+		{"0x_", token.INT, "0x_", "1:3: '_' must separate successive digits"},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer([]byte(tt.input))
+		tok := l.GetToken()
+		if tok.Type != tt.expectedType {
+			t.Errorf("%q: tokentype wrong. expected=%q, got=%q", tt.input, tt.expectedType, tok.Type)
+		}
+		if string(tok.Literal) != tt.expectedLiteral {
+			t.Errorf("%q: literal wrong. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		diags := l.Diagnostics()
+		if tt.expectedError == "" {
+			if len(diags) != 0 {
+				t.Errorf("%q: unexpected diagnostics: %v", tt.input, diags)
+			}
+			continue
+		}
+		if len(diags) != 1 {
+			t.Errorf("%q: wrong number of diagnostics. expected=1, got=%d", tt.input, len(diags))
+			continue
+		}
+		if diags[0].String() != tt.expectedError {
+			t.Errorf("%q: wrong diagnostic. expected=%q, got=%q", tt.input, tt.expectedError, diags[0].String())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "let a = 1; // one\n/* two /* nested */ still two */ a /* three */ / 2 // four"
+
+	tests := []token.TokenType{
+		token.LET,
+		token.IDENTIFIER,
+		token.ASSIGN,
+		token.INT,
+		token.SEMICOLON,
+		token.IDENTIFIER,
+		token.SLASH,
+		token.INT,
+		token.EOF,
+	}
+
+	l := NewLexer([]byte(input))
+	l.KeepComments()
+
+	for i, expectedType := range tests {
+		tok := l.GetToken()
+		if tok.Type != expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, expectedType, tok.Type)
+		}
+	}
+
+	expectedComments := []struct {
+		text  string
+		line  int
+		col   int
+		block bool
+	}{
+		{"// one", 1, 12, false},
+		{"/* two /* nested */ still two */", 2, 1, true},
+		{"/* three */", 2, 36, true},
+		{"// four", 2, 52, false},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		comment := comments[i]
+		if string(comment.Text) != expected.text {
+			t.Errorf("comments[%d] - text wrong. expected=%q, got=%q", i, expected.text, comment.Text)
+		}
+		if comment.Pos.Line != expected.line || comment.Pos.Column != expected.col {
+			t.Errorf("comments[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, expected.line, expected.col, comment.Pos.Line, comment.Pos.Column)
+		}
+		if comment.Block != expected.block {
+			t.Errorf("comments[%d] - block wrong. expected=%t, got=%t", i, expected.block, comment.Block)
+		}
+	}
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+}
+
+func TestCommentsNotKeptByDefault(t *testing.T) {
+	l := NewLexer([]byte("1 // one"))
+	for l.GetToken().Type != token.EOF {
+	}
+	if len(l.Comments()) != 0 {
+		t.Errorf("comments recorded without KeepComments. got=%d", len(l.Comments()))
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := NewLexer([]byte("1 /* open /* nested */"))
+
+	if tok := l.GetToken(); tok.Type != token.INT {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.INT, tok.Type)
+	}
+	if tok := l.GetToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	diags := l.Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("wrong number of diagnostics. expected=1, got=%d", len(diags))
+	}
+	if diags[0].String() != "1:3: unterminated block comment" {
+		t.Errorf("wrong diagnostic. got=%q", diags[0].String())
+	}
+}
+
+func TestWhitespace(t *testing.T) {
+	input := "let\ta = 1;\r\n\tlet b\u00a0=\u3000a\v+\f2;\u2028\r\nb"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENTIFIER, "a", 1, 5},
+		{token.ASSIGN, "=", 1, 7},
+		{token.INT, "1", 1, 9},
+		{token.SEMICOLON, ";", 1, 10},
+		{token.LET, "let", 2, 2},
+		{token.IDENTIFIER, "b", 2, 6},
+		{token.ASSIGN, "=", 2, 9},
+		{token.IDENTIFIER, "a", 2, 13},
+		{token.PLUS, "+", 2, 15},
+		{token.INT, "2", 2, 17},
+		{token.SEMICOLON, ";", 2, 18},
+		{token.IDENTIFIER, "b", 3, 1},
+		{token.EOF, "\x00", 3, 2},
+	}
+
+	l := NewLexer([]byte(input))
+
+	for i, tt := range tests {
+		tok := l.GetToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if string(tok.Literal) != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	l := NewLexer([]byte("\uFEFFlet"))
+
+	tok := l.GetToken()
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+	if tok.Pos.Offset != 3 {
+		t.Errorf("offset wrong. expected=3, got=%d", tok.Pos.Offset)
+	}
+}
+
+func TestIllegalMultiByteCharacter(t *testing.T) {
+	l := NewLexer([]byte("a € b"))
+	l.GetToken()
+
+	tok := l.GetToken()
+	if tok.Type != token.ILLEGAL || string(tok.Literal) != "€" {
+		t.Fatalf("wrong token. expected=ILLEGAL \"€\", got=%s %q", tok.Type, tok.Literal)
+	}
+	if tok = l.GetToken(); tok.Type != token.IDENTIFIER || tok.Pos.Column != 7 {
+		t.Errorf("wrong token after illegal character. got=%s at %s", tok.Type, tok.Pos)
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"foo_bar x1 _", []string{"foo_bar", "x1", "_"}},
+		{"größe δ2 名前", []string{"größe", "δ2", "名前"}},
+		{"x٣ _٣", []string{"x٣", "_٣"}},
+		{"a€b", []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer([]byte(tt.input))
+		identifiers := []string{}
+		for tok := l.GetToken(); tok.Type != token.EOF; tok = l.GetToken() {
+			if tok.Type == token.IDENTIFIER {
+				identifiers = append(identifiers, string(tok.Literal))
+			}
+		}
+		if fmt.Sprint(identifiers) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: wrong identifiers. expected=%q, got=%q", tt.input, tt.expected, identifiers)
+		}
+	}
+
+	// a digit cannot start an identifier, even if it is not an ASCII one
+	tok := NewLexer([]byte("٣x")).GetToken()
+	if tok.Type != token.ILLEGAL || string(tok.Literal) != "٣" {
+		t.Errorf("wrong token. expected=ILLEGAL \"٣\", got=%s %q", tok.Type, tok.Literal)
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	var source strings.Builder
+	source.WriteString("/* generated */\r\n")
+	for i := 0; source.Len() < 3*readChunkSize; i++ {
+		fmt.Fprintf(&source, "let välue_%s = [%d, 2.5, 0x_FF, 1_0.5e-3, \"text\"]; // entry\r\n", strings.Repeat("x", i%7), i)
+	}
+	input := source.String()
+
+	readers := map[string]io.Reader{
+		"chunked":   strings.NewReader(input),
+		"one byte":  iotest.OneByteReader(strings.NewReader(input)),
+		"half read": iotest.HalfReader(strings.NewReader(input)),
+	}
+
+	for name, reader := range readers {
+		expected := NewFileLexer("gen.monkey", []byte(input))
+		expected.KeepComments()
+		actual := NewReaderLexer("gen.monkey", reader)
+		actual.KeepComments()
+
+		var tokens []token.Token
+		for {
+			want := expected.GetToken()
+			got := actual.GetToken()
+			if got.Type != want.Type || !bytes.Equal(got.Literal, want.Literal) || got.Pos != want.Pos {
+				t.Fatalf("%s: wrong token. expected=%s %q at %s, got=%s %q at %s", name,
+					want.Type, want.Literal, want.Pos, got.Type, got.Literal, got.Pos)
+			}
+			tokens = append(tokens, got)
+			if want.Type == token.EOF {
+				break
+			}
+		}
+
+		// literals of earlier tokens must survive refilling the buffer
+		for i, tok := range tokens {
+			start := tok.Pos.Offset
+			if tok.Type == token.STRING {
+				start += 1 // skip the opening quote
+			}
+			if tok.Type != token.EOF && string(tok.Literal) != input[start:start+len(tok.Literal)] {
+				t.Fatalf("%s: literal of token %d changed. got=%q", name, i, tok.Literal)
+			}
+		}
+		if len(actual.Comments()) != len(expected.Comments()) {
+			t.Errorf("%s: wrong number of comments. expected=%d, got=%d",
+				name, len(expected.Comments()), len(actual.Comments()))
+		}
+		if string(actual.Comments()[0].Text) != "/* generated */" {
+			t.Errorf("%s: wrong first comment. got=%q", name, actual.Comments()[0].Text)
+		}
+		if len(actual.Diagnostics()) != 0 {
+			t.Errorf("%s: unexpected diagnostics: %v", name, actual.Diagnostics())
+		}
+	}
+}
+
+func TestReaderLexerEscapes(t *testing.T) {
+	// escapes, valid or not, at every offset across the refills of the buffer
+	var source strings.Builder
+	for i := 0; source.Len() < 3*readChunkSize; i++ {
+		fmt.Fprintf(&source, "let s = \"%s\\u{1F600}\\q\\é\\u{110000}\\u{12\";\n", strings.Repeat("x", i%11))
+	}
+	input := source.String()
+
+	expected := NewFileLexer("esc.monkey", []byte(input))
+	actual := NewReaderLexer("esc.monkey", iotest.OneByteReader(strings.NewReader(input)))
+	for {
+		want := expected.GetToken()
+		got := actual.GetToken()
+		if got.Type != want.Type || !bytes.Equal(got.Literal, want.Literal) || got.Pos != want.Pos {
+			t.Fatalf("wrong token. expected=%s %q at %s, got=%s %q at %s",
+				want.Type, want.Literal, want.Pos, got.Type, got.Literal, got.Pos)
+		}
+		if want.Type == token.EOF {
+			break
+		}
+	}
+
+	if len(actual.Diagnostics()) != len(expected.Diagnostics()) {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d",
+			len(expected.Diagnostics()), len(actual.Diagnostics()))
+	}
+	for i, d := range actual.Diagnostics() {
+		if d.String() != expected.Diagnostics()[i].String() || d.Span != expected.Diagnostics()[i].Span {
+			t.Fatalf("wrong diagnostic %d. expected=%q, got=%q", i, expected.Diagnostics()[i], d)
+		}
+	}
+}
+
+func TestReaderLexerReadError(t *testing.T) {
+	reader := io.MultiReader(strings.NewReader("let a"), iotest.ErrReader(errors.New("disk on fire")))
+	l := NewReaderLexer("broken.monkey", reader)
+
+	for _, expected := range []token.TokenType{token.LET, token.IDENTIFIER, token.EOF} {
+		if tok := l.GetToken(); tok.Type != expected {
+			t.Fatalf("tokentype wrong. expected=%q, got=%q", expected, tok.Type)
+		}
+	}
+
+	diags := l.Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("wrong number of diagnostics. expected=1, got=%d", len(diags))
+	}
+	if diags[0].String() != "broken.monkey:1:6: could not read input: disk on fire" {
+		t.Errorf("wrong diagnostic. got=%q", diags[0].String())
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue string
+		expectedError string
+	}{
+		{`"hello world"`, "hello world", ""},
+		{`""`, "", ""},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd", ""},
+		{`"say \"hi\""`, `say "hi"`, ""},
+		{`"back\\slash"`, `back\slash`, ""},
+		{`"\u{48}\u{49}"`, "HI", ""},
+		{`"\u{1F600} \u{e9}"`, "😀 é", ""},
+		{`"héllo"`, "héllo", ""},
+		{"`raw \\n string`", `raw \n string`, ""},
+		{"`multi\nline`", "multi\nline", ""},
+		{"`crlf\r\nline`", "crlf\nline", ""},
+		{"`\"quoted\"`", `"quoted"`, ""},
+		{`"open`, "open", "1:1: unterminated string literal"},
+		{"\"open\nx\"", "open", "1:1: unterminated string literal"},
+		{"\"open\\", "open", "1:1: unterminated string literal"},
+		{"`open", "open", "1:1: unterminated raw string literal"},
+		{`"a\qb"`, "ab", `1:3: invalid escape sequence \q`},
+		{`"a\éb"`, "ab", `1:3: invalid escape sequence \é`},
+		{`"\u0041"`, "0041", `1:2: invalid escape sequence \u: expected a code point in braces, as in \u{1F600}`},
+		{`"\u{}"`, "", `1:2: invalid escape sequence \u{}: expected 1 to 6 hexadecimal digits and a closing brace`},
+		{`"\u{41"`, "", `1:2: invalid escape sequence \u{41: expected 1 to 6 hexadecimal digits and a closing brace`},
+		{`"\u{1234567}"`, "", `1:2: invalid escape sequence \u{1234567}: expected 1 to 6 hexadecimal digits and a closing brace`},
+		{`"\u{D800}"`, "", `1:2: invalid escape sequence \u{D800}: not a valid Unicode code point`},
+		{`"\u{110000}"`, "", `1:2: invalid escape sequence \u{110000}: not a valid Unicode code point`},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer([]byte(tt.input))
+		tok := l.GetToken()
+		if tok.Type != token.STRING {
+			t.Fatalf("%q: tokentype wrong. expected=%q, got=%q", tt.input, token.STRING, tok.Type)
+		}
+		if string(tok.Literal) != tt.expectedValue {
+			t.Errorf("%q: value wrong. expected=%q, got=%q", tt.input, tt.expectedValue, tok.Literal)
+		}
+
+		diags := l.Diagnostics()
+		if tt.expectedError == "" {
+			if len(diags) != 0 {
+				t.Errorf("%q: unexpected diagnostics: %v", tt.input, diags)
+			}
+			continue
+		}
+		if len(diags) != 1 {
+			t.Errorf("%q: wrong number of diagnostics. expected=1, got=%d", tt.input, len(diags))
+			continue
+		}
+		if diags[0].String() != tt.expectedError {
+			t.Errorf("%q: wrong diagnostic. expected=%q, got=%q", tt.input, tt.expectedError, diags[0].String())
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"Hi ${name}, ${ {"a": "}"}["a"] } and ${"x${y}"}!" "\${no}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_START, "Hi "},
+		{token.IDENTIFIER, "name"},
+		{token.STRING_MIDDLE, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.STRING, "}"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.STRING_MIDDLE, " and "},
+		{token.STRING_START, "x"},
+		{token.IDENTIFIER, "y"},
+		{token.STRING_END, ""},
+		{token.STRING_END, "!"},
+		{token.STRING, "${no}"},
+		{token.EOF, "\x00"},
+	}
+
+	l := NewLexer([]byte(input))
+	for i, tt := range tests {
+		tok := l.GetToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if string(tok.Literal) != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+	if diags := l.Diagnostics(); len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+}
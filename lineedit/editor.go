@@ -0,0 +1,498 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Returned by ReadLine when the line is abandoned with Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// Most lines kept in the history
+const maxHistory = 1000
+
+// Control keys
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	ctrlJ     = 10
+	ctrlK     = 11
+	ctrlL     = 12
+	enter     = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlT     = 20
+	ctrlU     = 21
+	ctrlW     = 23
+	ctrlY     = 25
+	escape    = 27
+	backspace = 127
+)
+
+// Keys sent as escape sequences, outside the range of characters
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyWordLeft
+	keyWordRight
+	keyUnknown
+)
+
+// Line editor reading from a terminal. When the input is not a terminal,
+// lines are read as they are, without editing.
+type Editor struct {
+	reader *bufio.Reader
+	out    io.Writer
+	// terminal file descriptor, or -1 if the input is not a terminal
+	fd int
+
+	history     []string
+	historyFile string
+
+	// returns the words that may complete the word before the cursor
+	Complete func(word string) []string
+
+	// state of the line being edited
+	line   []rune
+	pos    int
+	prompt string
+	killed []rune
+}
+
+// Creates new editor reading from in and echoing to out
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{reader: bufio.NewReader(in), out: out, fd: -1}
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e.fd = int(f.Fd())
+	}
+	return e
+}
+
+// Reports whether lines are read from a terminal with editing
+func (e *Editor) Terminal() bool {
+	return e.fd >= 0
+}
+
+// Shows prompt and reads a line, without its line ending. Returns io.EOF at
+// the end of input and ErrInterrupted when the line is abandoned.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.Terminal() {
+		io.WriteString(e.out, prompt)
+		line, err := e.reader.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	return e.edit(prompt)
+}
+
+// Loads the history kept in path and appends lines added later to it. A
+// missing file is not an error.
+func (e *Editor) LoadHistory(path string) error {
+	e.historyFile = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	return nil
+}
+
+// Adds line to the history, and to the history file if there is one.
+// Empty lines and repeats of the last line are not added.
+func (e *Editor) AddHistory(line string) error {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return nil
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Returns the lines in the history, oldest first
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// Reads a line key by key, redrawing it after each change
+func (e *Editor) edit(prompt string) (string, error) {
+	e.line, e.pos, e.prompt = nil, 0, prompt
+	// index into the history of the line shown, len(history) for a new one
+	historyIndex := len(e.history)
+	// the new line, kept while browsing the history
+	var pending []rune
+
+	e.refresh()
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case enter, ctrlJ:
+			io.WriteString(e.out, "\r\n")
+			return string(e.line), nil
+		case ctrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case ctrlD:
+			if len(e.line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case keyDelete:
+			e.delete(e.pos, e.pos+1)
+		case backspace, ctrlH:
+			e.delete(e.pos-1, e.pos)
+		case ctrlA, keyHome:
+			e.pos = 0
+		case ctrlE, keyEnd:
+			e.pos = len(e.line)
+		case ctrlB, keyLeft:
+			e.pos = max(e.pos-1, 0)
+		case ctrlF, keyRight:
+			e.pos = min(e.pos+1, len(e.line))
+		case keyWordLeft:
+			e.pos = e.wordStart()
+		case keyWordRight:
+			e.pos = e.wordEnd()
+		case ctrlK:
+			e.kill(e.pos, len(e.line))
+		case ctrlU:
+			e.kill(0, e.pos)
+		case ctrlW:
+			e.kill(e.wordStart(), e.pos)
+		case ctrlY:
+			e.insert(e.killed...)
+		case ctrlT:
+			e.transpose()
+		case ctrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case ctrlP, keyUp, ctrlN, keyDown:
+			next := historyIndex - 1
+			if key == ctrlN || key == keyDown {
+				next = historyIndex + 1
+			}
+			if next < 0 || next > len(e.history) {
+				break
+			}
+			if historyIndex == len(e.history) {
+				pending = e.line
+			}
+			historyIndex = next
+			if next == len(e.history) {
+				e.line = pending
+			} else {
+				e.line = []rune(e.history[next])
+			}
+			e.pos = len(e.line)
+		case ctrlR:
+			line, accepted, err := e.search()
+			if err != nil {
+				return "", err
+			}
+			if accepted {
+				return line, nil
+			}
+		case tab:
+			e.complete()
+		case keyUnknown, escape, ctrlG:
+		default:
+			if key >= ' ' {
+				e.insert(key)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// Reads a key, decoding escape sequences
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.reader.ReadRune()
+	if err != nil || r != escape {
+		return r, err
+	}
+
+	next, _, err := e.reader.ReadRune()
+	if err != nil {
+		return escape, nil
+	}
+	switch next {
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	case '[', 'O':
+	default:
+		return keyUnknown, nil
+	}
+
+	// CSI or SS3 sequence: parameters followed by a final letter or ~
+	var params strings.Builder
+	for {
+		c, _, err := e.reader.ReadRune()
+		if err != nil {
+			return keyUnknown, nil
+		}
+		switch {
+		case c == '~':
+			switch params.String() {
+			case "1", "7":
+				return keyHome, nil
+			case "3":
+				return keyDelete, nil
+			case "4", "8":
+				return keyEnd, nil
+			}
+			return keyUnknown, nil
+		case unicode.IsLetter(c):
+			switch c {
+			case 'A':
+				return keyUp, nil
+			case 'B':
+				return keyDown, nil
+			case 'C':
+				return keyRight, nil
+			case 'D':
+				return keyLeft, nil
+			case 'H':
+				return keyHome, nil
+			case 'F':
+				return keyEnd, nil
+			}
+			return keyUnknown, nil
+		}
+		params.WriteRune(c)
+	}
+}
+
+// Redraws the line and places the cursor
+func (e *Editor) refresh() {
+	e.draw(e.prompt, e.line, e.pos)
+}
+
+func (e *Editor) draw(prompt string, line []rune, pos int) {
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	out.WriteString(string(line))
+	out.WriteString("\x1b[K\r")
+	if n := len([]rune(prompt)) + pos; n > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", n)
+	}
+	io.WriteString(e.out, out.String())
+}
+
+func (e *Editor) insert(chars ...rune) {
+	line := make([]rune, 0, len(e.line)+len(chars))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, chars...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(chars)
+}
+
+// Removes the characters from start up to end, within the line
+func (e *Editor) delete(start, end int) {
+	start, end = max(start, 0), min(end, len(e.line))
+	if start >= end {
+		return
+	}
+	e.line = append(e.line[:start:start], e.line[end:]...)
+	if e.pos > end {
+		e.pos -= end - start
+	} else if e.pos > start {
+		e.pos = start
+	}
+}
+
+// Removes the characters from start up to end, keeping them to be yanked
+func (e *Editor) kill(start, end int) {
+	if start >= end {
+		return
+	}
+	e.killed = append([]rune(nil), e.line[start:end]...)
+	e.delete(start, end)
+}
+
+// Swaps the characters before and at the cursor, or the last two at the end
+// of the line
+func (e *Editor) transpose() {
+	if len(e.line) < 2 || e.pos == 0 {
+		return
+	}
+	if e.pos == len(e.line) {
+		e.pos -= 1
+	}
+	e.line[e.pos-1], e.line[e.pos] = e.line[e.pos], e.line[e.pos-1]
+	e.pos += 1
+}
+
+// Returns the start of the word before the cursor
+func (e *Editor) wordStart() int {
+	i := e.pos
+	for i > 0 && !isWordChar(e.line[i-1]) {
+		i -= 1
+	}
+	for i > 0 && isWordChar(e.line[i-1]) {
+		i -= 1
+	}
+	return i
+}
+
+// Returns the end of the word after the cursor
+func (e *Editor) wordEnd() int {
+	i := e.pos
+	for i < len(e.line) && !isWordChar(e.line[i]) {
+		i += 1
+	}
+	for i < len(e.line) && isWordChar(e.line[i]) {
+		i += 1
+	}
+	return i
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Completes the word before the cursor. When several words match, the
+// common prefix is inserted, or the matches are listed if there is none.
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && (isWordChar(e.line[start-1]) || e.line[start-1] == ':') {
+		start -= 1
+	}
+	word := string(e.line[start:e.pos])
+
+	candidates := e.Complete(word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		prefix = append(prefix, ' ')
+	}
+
+	if n := len([]rune(word)); len(prefix) > n {
+		e.insert(prefix[n:]...)
+		return
+	}
+	if len(candidates) > 1 {
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+// Searches the history backwards for lines containing what is typed, as
+// with Ctrl-R in a shell. Enter runs the match found, Ctrl-G and Ctrl-C go
+// back to the line as it was, and any other key starts editing the match.
+func (e *Editor) search() (string, bool, error) {
+	var query []rune
+	index := len(e.history)
+	match := ""
+
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				index, match = i, e.history[i]
+				return
+			}
+		}
+	}
+
+	for {
+		prompt := fmt.Sprintf("(reverse-i-search)`%s': ", string(query))
+		matched := []rune(match)
+		e.draw(prompt, matched, len(matched))
+
+		key, err := e.readKey()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch key {
+		case ctrlR:
+			find(index - 1)
+		case backspace, ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		case enter, ctrlJ:
+			io.WriteString(e.out, "\r\n")
+			return match, true, nil
+		case ctrlG, ctrlC:
+			return "", false, nil
+		default:
+			if key >= ' ' {
+				query = append(query, key)
+				find(min(index, len(e.history)-1))
+				continue
+			}
+			e.line, e.pos = matched, len(matched)
+			return "", false, nil
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package lineedit
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Edits a line from keys, as typed in a terminal
+func editLine(e *Editor, keys string) (string, error) {
+	e.reader.Reset(strings.NewReader(keys))
+	return e.edit("> ")
+}
+
+func TestEditing(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"typing", "let x = 1;\r", "let x = 1;"},
+		{"unicode", "größe\r", "größe"},
+		{"backspace", "abcd\x7f\x7fx\r", "abx"},
+		{"start and end", "bc\x01a\x05d\r", "abcd"},
+		{"arrows", "ac\x1b[Db\x1b[C\x1b[Cd\r", "abcd"},
+		{"home and end keys", "b\x1b[Ha\x1b[Fc\x1b[1~_\x1b[4~!\r", "_abc!"},
+		{"back and forward", "ac\x02b\x06d\r", "abcd"},
+		{"delete under cursor", "abc\x01\x04\x1b[3~\r", "c"},
+		{"kill to end and yank", "hello world\x01\x06\x06\x06\x06\x06\x0b\x01\x19 \r", " world hello"},
+		{"kill to start", "hello world\x02\x02\x15\r", "ld"},
+		{"kill word", "let foo_bar = \x17x\r", "let x"},
+		{"word moves", "one two three\x1bb\x1bbX\x1bf\x1bfY\r", "one Xtwo threeY"},
+		{"transpose", "ab\x14\r", "ba"},
+		{"transpose inside", "abc\x02\x02\x14\r", "bac"},
+		{"unknown sequences", "a\x1b[5~\x1bxb\r", "ab"},
+		{"ctrl-d inside line", "ab\x02\x04\r", "a"},
+	}
+
+	for _, tt := range tests {
+		e := New(strings.NewReader(""), io.Discard)
+		line, err := editLine(e, tt.keys)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. expected=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestInterruptAndEOF(t *testing.T) {
+	e := New(strings.NewReader(""), io.Discard)
+	if _, err := editLine(e, "abc\x03"); err != ErrInterrupted {
+		t.Errorf("Ctrl-C did not interrupt. got=%v", err)
+	}
+	if _, err := editLine(e, "\x04"); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line did not end input. got=%v", err)
+	}
+	if _, err := editLine(e, "abc"); err != io.EOF {
+		t.Errorf("end of input did not end input. got=%v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("let a = 1;\nlet b = 2;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(strings.NewReader(""), io.Discard)
+	if err := e.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	e.AddHistory("a + b")
+	e.AddHistory("a + b")
+	e.AddHistory("  ")
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"previous", "\x1b[A\r", "a + b"},
+		{"oldest", "\x10\x10\x10\x10\x10\r", "let a = 1;"},
+		{"back to new line", "new\x1b[A\x1b[A\x1b[B\x1b[B\r", "new"},
+		{"edit entry", "\x10\x10\x7f\x7f3;\r", "let b = 3;"},
+		{"reverse search", "\x12let\r", "let b = 2;"},
+		{"reverse search again", "\x12let\x12\r", "let a = 1;"},
+		{"reverse search and edit", "\x12+\x05 + 1\r", "a + b + 1"},
+		{"reverse search cancelled", "x\x12let\x07\r", "x"},
+		{"reverse search backspace", "\x12b\x12\x7f\r", "a + b"},
+	}
+	for _, tt := range tests {
+		line, err := editLine(e, tt.keys)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. expected=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "let a = 1;\nlet b = 2;\na + b\n" {
+		t.Errorf("wrong history file. got=%q", data)
+	}
+
+	e = New(strings.NewReader(""), io.Discard)
+	if err := e.LoadHistory(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("missing history file is an error: %s", err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	words := []string{"let", "len", "length", "größe", ":help"}
+	complete := func(word string) []string {
+		matches := []string{}
+		for _, w := range words {
+			if strings.HasPrefix(w, word) {
+				matches = append(matches, w)
+			}
+		}
+		return matches
+	}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"gr\t\r", "größe "},
+		{"x = leng\t\r", "x = length "},
+		{"le\t\r", "le"},
+		{"len\t\tx\r", "lenx"},
+		{":he\t\r", ":help "},
+		{"zz\t\r", "zz"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		e := New(strings.NewReader(""), &out)
+		e.Complete = complete
+		line, err := editLine(e, tt.keys)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.keys, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%q: wrong line. expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+
+	// ambiguous words are listed
+	var out strings.Builder
+	e := New(strings.NewReader(""), &out)
+	e.Complete = complete
+	editLine(e, "len\t\r")
+	if !strings.Contains(out.String(), "\r\nlen  length\r\n") {
+		t.Errorf("matches not listed. got=%q", out.String())
+	}
+}
+
+func TestReadLineWithoutTerminal(t *testing.T) {
+	var out strings.Builder
+	e := New(strings.NewReader("first\r\nsecond"), &out)
+	if e.Terminal() {
+		t.Fatal("a string reader is not a terminal")
+	}
+
+	for _, expected := range []string{"first", "second"} {
+		line, err := e.ReadLine("> ")
+		if err != nil || line != expected {
+			t.Errorf("wrong line. expected=%q, got=%q (%v)", expected, line, err)
+		}
+	}
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("expected io.EOF, got=%v", err)
+	}
+	if out.String() != "> > > " {
+		t.Errorf("wrong prompts. got=%q", out.String())
+	}
+}
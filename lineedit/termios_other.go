@@ -0,0 +1,15 @@
+//go:build !linux
+
+package lineedit
+
+import "errors"
+
+// Terminal modes are only switched on Linux; elsewhere lines are read
+// without editing
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this system")
+}
@@ -1,20 +1,120 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
 	repl "interpreter/repl"
+	"interpreter/vm"
 )
 
+const USAGE = "Usage: go run main.go [--json] [--vm] [filename] | [--repl]"
+
+type options struct {
+	// report diagnostics as JSON
+	json bool
+	// execute with the bytecode virtual machine instead of the evaluator
+	vm bool
+}
+
 func main() {
-	fmt.Println(os.Args)
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go [filename] [--repl]")
+	var opts options
+
+	startRepl := flag.Bool("repl", false, "start an interactive session")
+	flag.BoolVar(&opts.json, "json", false, "report diagnostics as JSON")
+	flag.BoolVar(&opts.vm, "vm", false, "run on the bytecode virtual machine")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, USAGE)
+		flag.PrintDefaults()
 	}
-	args := os.Args[1]
+	flag.Parse()
 
-	if args == "--repl" {
+	if *startRepl && flag.NArg() == 0 {
 		repl.Start(os.Stdin, os.Stdout)
+		return
+	}
+
+	if *startRepl || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	os.Exit(runFile(flag.Arg(0), os.Stderr, opts))
+}
+
+// Runs the script at path and returns the process exit code. Diagnostics are
+// written to errOut.
+func runFile(path string, errOut io.Writer, opts options) int {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(errOut, "could not read %s: %s\n", path, err)
+		return 1
+	}
+
+	l := lexer.NewFileLexer(path, input)
+	p := parser.NewParser(l)
+
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		reportDiagnostics(errOut, input, p.Diagnostics(), opts)
+		return 1
+	}
+
+	result, ok := execute(path, program, errOut, opts)
+	if !ok {
+		return 1
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		reportDiagnostics(errOut, input, []*diagnostic.Diagnostic{errObj.Diagnostic()}, opts)
+		return 1
+	}
+
+	return 0
+}
+
+// Runs program with the evaluator, or the virtual machine for --vm,
+// reporting a failure to compile or run it to errOut. Reports false then. A
+// panic while running it gives an internal error as the result.
+func execute(path string, program *ast.Program, errOut io.Writer, opts options) (result object.Object, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, ok = evaluator.InternalError(r), true
+		}
+	}()
+
+	if opts.vm {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(errOut, "compilation failed: %s\n", err)
+			return nil, false
+		}
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			fmt.Fprintf(errOut, "%s: %s\n", path, err)
+			return nil, false
+		}
+		return machine.Result(), true
+	}
+
+	env := object.NewEnvironment()
+	return evaluator.Eval(program, env), true
+}
+
+func reportDiagnostics(out io.Writer, source []byte, diags []*diagnostic.Diagnostic, opts options) {
+	if opts.json {
+		diagnostic.RenderJSON(out, diags)
+		return
 	}
+	diagnostic.Render(out, source, diags)
 }
@@ -0,0 +1,411 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// Converts a Go value to an object: integers, floats, strings, booleans,
+// slices and arrays, maps, structs and pointers to them, with nil becoming
+// null. Struct fields become string keys of a hash, named by their `monkey`
+// tag or else their field name; a tag of "-" leaves the field out. Values
+// that refer back to themselves fail to convert.
+func FromGo(value any) (Object, error) {
+	return fromGo(reflect.ValueOf(value))
+}
+
+// Stores obj in the Go value target points to, converting it to the type of
+// that value the way FromGo converts the other way. A target of type any
+// receives int64, *big.Int, float64, string, bool, []any, map[string]any or
+// map[any]any, or nil for null.
+func ToGo(obj Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("cannot convert to %T: target must be a non-nil pointer", target)
+	}
+	value, err := toGo(obj, v.Type().Elem())
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(value)
+	return nil
+}
+
+// Converts a Go value to an object. Objects are returned as they are.
+func fromGo(v reflect.Value) (Object, error) {
+	return fromGoValue(v, map[reference]bool{})
+}
+
+// Identity of a pointer, map or slice, which may refer back to itself
+type reference struct {
+	ptr uintptr
+	typ reflect.Type
+	// slices of different lengths may start at the same element
+	len int
+}
+
+// Converts a Go value to an object, failing for one that refers back to
+// the references being converted around it
+func fromGoValue(v reflect.Value, visiting map[reference]bool) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+	if v.Type().Implements(objectType) {
+		if isNil(v) {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return NormalizeInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if !v.IsNil() {
+			ref := reference{ptr: v.Pointer(), typ: v.Type()}
+			if v.Kind() == reflect.Slice {
+				ref.len = v.Len()
+			}
+			if visiting[ref] {
+				return nil, fmt.Errorf("cannot convert cyclic Go value of type %s", v.Type())
+			}
+			visiting[ref] = true
+			defer delete(visiting, ref)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NormalizeInteger(new(big.Int).SetUint64(v.Uint())), nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			el, err := fromGoValue(v.Index(i), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		pairs := make(map[HashKey]HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromGoValue(iter.Key(), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("key %v: unusable as hash key: %s", iter.Key(), key.Type())
+			}
+			value, err := fromGoValue(iter.Value(), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("value of %v: %w", iter.Key(), err)
+			}
+			pairs[hashable.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}, nil
+
+	case reflect.Struct:
+		pairs := make(map[HashKey]HashPair)
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			value, err := fromGoValue(v.Field(i), visiting)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			key := &String{Value: name}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}, nil
+
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGoValue(v.Elem(), visiting)
+	}
+
+	return nil, fmt.Errorf("cannot convert Go value of type %s", v.Type())
+}
+
+// Converts obj to a Go value of type t
+func toGo(obj Object, t reflect.Type) (reflect.Value, error) {
+	if obj == nil || isNil(reflect.ValueOf(obj)) {
+		// statements without a value, such as let, produce no object
+		obj = NULL
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return toNaturalGo(obj, t)
+	}
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj), nil
+	}
+	if t == bigIntType {
+		switch obj := obj.(type) {
+		case *Integer:
+			return reflect.ValueOf(big.NewInt(obj.Value)), nil
+		case *BigInteger:
+			return reflect.ValueOf(new(big.Int).Set(obj.Value)), nil
+		}
+		return reflect.Value{}, cannotConvert(obj, t)
+	}
+
+	v := reflect.New(t).Elem()
+	if obj == NULL && isNil(v) {
+		// null is the zero value of pointers, slices and maps
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		v.SetBool(b.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*Integer)
+		if _, isBig := obj.(*BigInteger); isBig || (ok && v.OverflowInt(integer.Value)) {
+			return v, fmt.Errorf("%s out of range of %s", obj.Inspect(), t)
+		}
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		v.SetInt(integer.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var value *big.Int
+		switch obj := obj.(type) {
+		case *Integer:
+			value = big.NewInt(obj.Value)
+		case *BigInteger:
+			value = obj.Value
+		default:
+			return v, cannotConvert(obj, t)
+		}
+		if value.Sign() < 0 || !value.IsUint64() || v.OverflowUint(value.Uint64()) {
+			return v, fmt.Errorf("%s out of range of %s", obj.Inspect(), t)
+		}
+		v.SetUint(value.Uint64())
+
+	case reflect.Float32, reflect.Float64:
+		switch obj := obj.(type) {
+		case *Float:
+			v.SetFloat(obj.Value)
+		case *Integer:
+			v.SetFloat(float64(obj.Value))
+		case *BigInteger:
+			f, _ := new(big.Float).SetInt(obj.Value).Float64()
+			v.SetFloat(f)
+		default:
+			return v, cannotConvert(obj, t)
+		}
+
+	case reflect.String:
+		str, ok := obj.(*String)
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		v.SetString(str.Value)
+
+	case reflect.Slice:
+		array, ok := obj.(*Array)
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		v.Set(reflect.MakeSlice(t, len(array.Elements), len(array.Elements)))
+		if err := toGoElements(array, v); err != nil {
+			return v, err
+		}
+
+	case reflect.Array:
+		array, ok := obj.(*Array)
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		if len(array.Elements) != t.Len() {
+			return v, fmt.Errorf("cannot convert ARRAY of length %d to %s", len(array.Elements), t)
+		}
+		if err := toGoElements(array, v); err != nil {
+			return v, err
+		}
+
+	case reflect.Map:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		v.Set(reflect.MakeMapWithSize(t, len(hash.Pairs)))
+		for _, pair := range hash.Pairs {
+			key, err := toGo(pair.Key, t.Key())
+			if err != nil {
+				return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value, err := toGo(pair.Value, t.Elem())
+			if err != nil {
+				return v, fmt.Errorf("value of %s: %w", pair.Key.Inspect(), err)
+			}
+			v.SetMapIndex(key, value)
+		}
+
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return v, cannotConvert(obj, t)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			pair, ok := hash.Pairs[(&String{Value: name}).HashKey()]
+			if !ok {
+				// missing keys leave the field zero
+				continue
+			}
+			value, err := toGo(pair.Value, t.Field(i).Type)
+			if err != nil {
+				return v, fmt.Errorf("field %s: %w", name, err)
+			}
+			v.Field(i).Set(value)
+		}
+
+	case reflect.Pointer:
+		elem, err := toGo(obj, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+
+	default:
+		return v, fmt.Errorf("cannot convert to Go type %s", t)
+	}
+
+	return v, nil
+}
+
+// Converts the elements of array into the slice or array v
+func toGoElements(array *Array, v reflect.Value) error {
+	for i, el := range array.Elements {
+		value, err := toGo(el, v.Type().Elem())
+		if err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+		v.Index(i).Set(value)
+	}
+	return nil
+}
+
+// Converts obj to the Go value closest to it, for an empty interface type t:
+// int64, *big.Int, float64, string, bool, []any, map[string]any when all
+// keys are strings or map[any]any otherwise, and nil for null
+func toNaturalGo(obj Object, t reflect.Type) (reflect.Value, error) {
+	var value any
+	switch obj := obj.(type) {
+	case *Null:
+		return reflect.Zero(t), nil
+	case *Integer:
+		value = obj.Value
+	case *BigInteger:
+		value = new(big.Int).Set(obj.Value)
+	case *Float:
+		value = obj.Value
+	case *String:
+		value = obj.Value
+	case *Boolean:
+		value = obj.Value
+	case *Array:
+		elements := make([]any, len(obj.Elements))
+		v := reflect.ValueOf(elements)
+		if err := toGoElements(obj, v); err != nil {
+			return reflect.Value{}, err
+		}
+		value = elements
+	case *Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs {
+			if _, ok := pair.Key.(*String); !ok {
+				stringKeys = false
+			}
+		}
+		mapType := reflect.TypeOf(map[any]any{})
+		if stringKeys {
+			mapType = reflect.TypeOf(map[string]any{})
+		}
+		v, err := toGo(obj, mapType)
+		if err != nil {
+			return v, err
+		}
+		value = v.Interface()
+	default:
+		// functions and other values without a Go counterpart
+		value = obj
+	}
+
+	v := reflect.New(t).Elem()
+	v.Set(reflect.ValueOf(value))
+	return v, nil
+}
+
+// Returns the hash key of the struct field f, and false if it is
+// unexported or tagged `monkey:"-"`
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get("monkey")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	}
+	return tag, true
+}
+
+func cannotConvert(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+// Reports whether v is a nil pointer, map, slice, function or interface
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Interface, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
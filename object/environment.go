@@ -1,13 +1,18 @@
 package object
 
+import "sort"
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	host  *Host
 }
 
+// Creates new global environment, with a host of its own using the standard
+// streams of the process
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, host: &Host{}}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -23,8 +28,46 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Rebinds name in the innermost scope that declares it. Reports false if no
+// enclosing scope declares name.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the names bound in this and all enclosing scopes in sorted order
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, host: outer.host}
+}
+
+// Returns the host running evaluations in this environment
+func (e *Environment) Host() *Host {
+	return e.host
+}
+
+// Sets the host running evaluations in this environment and the scopes
+// enclosed by it later on
+func (e *Environment) SetHost(host *Host) {
+	e.host = host
 }
@@ -0,0 +1,86 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+
+	"interpreter/diagnostic"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Wraps the Go function fn as a builtin named name. Arguments are converted
+// to the types of its parameters, and its result to an object. fn may
+// return nothing, a value, an error, or a value and an error; a non-nil
+// error is returned to the script as an error object.
+func NewGoBuiltin(name string, fn any) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("builtin %s: %T is not a function", name, fn)
+	}
+
+	t := v.Type()
+	switch {
+	case t.NumOut() <= 1:
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+	default:
+		return nil, fmt.Errorf("builtin %s: function must return at most a value and an error, got %s", name, t)
+	}
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		return callGo(name, v, args)
+	}}, nil
+}
+
+func callGo(name string, fn reflect.Value, args []Object) (result Object) {
+	t := fn.Type()
+	want := t.NumIn()
+	if t.IsVariadic() {
+		want -= 1
+	}
+	if len(args) < want || (!t.IsVariadic() && len(args) > want) {
+		wanted := fmt.Sprint(want)
+		if t.IsVariadic() {
+			wanted += " or more"
+		}
+		return &Error{Code: diagnostic.WRONG_ARGUMENT_COUNT,
+			Message: fmt.Sprintf("wrong number of arguments: want=%s, got=%d", wanted, len(args))}
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		paramType := t.In(min(i, t.NumIn()-1))
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			paramType = paramType.Elem()
+		}
+		value, err := toGo(arg, paramType)
+		if err != nil {
+			return &Error{Code: diagnostic.TYPE_MISMATCH,
+				Message: fmt.Sprintf("argument %d to `%s`: %s", i+1, name, err)}
+		}
+		in[i] = value
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = &Error{Message: fmt.Sprintf("panic in `%s`: %v", name, r)}
+		}
+	}()
+	out := fn.Call(in)
+
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return &Error{Message: err.Error()}
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return NULL
+	}
+
+	obj, err := fromGo(out[0])
+	if err != nil {
+		return &Error{Message: fmt.Sprintf("result of `%s`: %s", name, err)}
+	}
+	return obj
+}
@@ -0,0 +1,152 @@
+package object
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"interpreter/diagnostic"
+	"interpreter/token"
+)
+
+// Settings of the program running an evaluation, shared by all scopes of
+// its environment. A nil host or unset stream stands for the process's own.
+type Host struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	// Stops the evaluation once done, nil to let it run to the end
+	Context context.Context
+	// Number of steps the evaluation may take, unlimited if 0
+	MaxSteps int
+	// Number of steps taken so far, reset it to start a new budget
+	Steps int
+	// Number of function calls that may be nested, DefaultMaxCallDepth if 0
+	MaxCallDepth int
+
+	// functions being called, innermost last
+	calls []CallFrame
+
+	// reads lines from Stdin, keeping what was read ahead between them
+	stdin *bufio.Reader
+}
+
+// Returns the writer for regular output
+func (h *Host) Out() io.Writer {
+	if h == nil || h.Stdout == nil {
+		return os.Stdout
+	}
+	return h.Stdout
+}
+
+// Returns the writer for error output
+func (h *Host) Err() io.Writer {
+	if h == nil || h.Stderr == nil {
+		return os.Stderr
+	}
+	return h.Stderr
+}
+
+// Reads a line of input without its line ending. Reports false at the end
+// of input.
+func (h *Host) ReadLine() (string, bool) {
+	if h == nil {
+		return readLine(stdinReader)
+	}
+	if h.stdin == nil {
+		if h.Stdin == nil {
+			return readLine(stdinReader)
+		}
+		h.stdin = bufio.NewReader(h.Stdin)
+	}
+	return readLine(h.stdin)
+}
+
+// the context is only checked every so many steps, as that is slower
+const contextCheckInterval = 256
+
+// Counts a step of the evaluation. Returns an error for the evaluation to
+// stop with if it ran out of steps or its context is done, nil otherwise.
+func (h *Host) Step() *Error {
+	h.Steps++
+	if h.MaxSteps > 0 && h.Steps > h.MaxSteps {
+		return &Error{Code: diagnostic.STEP_LIMIT_EXCEEDED,
+			Message: fmt.Sprintf("step limit exceeded: evaluation took more than %d steps", h.MaxSteps)}
+	}
+	if h.Context != nil && h.Steps%contextCheckInterval == 0 {
+		if err := h.Context.Err(); err != nil {
+			return &Error{Code: diagnostic.CANCELED, Message: fmt.Sprintf("evaluation stopped: %s", err)}
+		}
+	}
+	return nil
+}
+
+// Default bound on nested function calls, well below the depth at which
+// the evaluator would exhaust the Go stack
+const DefaultMaxCallDepth = 10000
+
+// number of innermost calls listed when the call depth is exceeded
+const reportedCallFrames = 5
+
+// Function call in progress
+type CallFrame struct {
+	// called expression, such as the name of the function
+	Function string
+	// position of the call, invalid for calls made by the host
+	Pos token.Position
+}
+
+func (f CallFrame) String() string {
+	if !f.Pos.IsValid() {
+		return fmt.Sprintf("in %s called by the host", f.Function)
+	}
+	return fmt.Sprintf("in %s called at %s", f.Function, f.Pos)
+}
+
+// Records the start of a call to function at pos, to be ended by ExitCall.
+// Returns an error listing the innermost calls if that would nest more calls
+// than allowed, nil otherwise.
+func (h *Host) EnterCall(function string, pos token.Position) *Error {
+	maxDepth := h.MaxCallDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxCallDepth
+	}
+	if len(h.calls) >= maxDepth {
+		err := &Error{Code: diagnostic.CALL_DEPTH_EXCEEDED,
+			Message: fmt.Sprintf("maximum recursion depth exceeded: more than %d nested calls", maxDepth)}
+		for i := len(h.calls) - 1; i >= 0 && i >= len(h.calls)-reportedCallFrames; i-- {
+			err.Notes = append(err.Notes, h.calls[i].String())
+		}
+		if hidden := len(h.calls) - reportedCallFrames; hidden > 0 {
+			err.Notes = append(err.Notes, fmt.Sprintf("... and %d calls before", hidden))
+		}
+		return err
+	}
+	h.calls = append(h.calls, CallFrame{Function: function, Pos: pos})
+	return nil
+}
+
+// Records the end of the innermost call
+func (h *Host) ExitCall() {
+	h.calls = h.calls[:len(h.calls)-1]
+}
+
+// shared by all evaluations reading from the process's standard input
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func readLine(r *bufio.Reader) (string, bool) {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, true
+}
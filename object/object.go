@@ -4,13 +4,26 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/diagnostic"
+	"interpreter/token"
 )
 
 type ObjectType string
 
+// The only null and boolean values, which are compared by identity
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -18,6 +31,7 @@ type Object interface {
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -27,6 +41,13 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	ITERATOR_OBJ          = "ITERATOR"
+	CELL_OBJ              = "CELL"
 )
 
 type Integer struct {
@@ -41,6 +62,58 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+// Integer too large for an int64. Values that fit in an int64 are always
+// represented by Integer, so every integer has a single representation.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Inspect() string {
+	return bi.Value.String()
+}
+
+func (bi *BigInteger) Type() ObjectType {
+	return INTEGER_OBJ
+}
+
+// Returns value as an Integer if it fits in an int64, else as a BigInteger
+func NormalizeInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+// Returns the value of an Integer or BigInteger as a new big.Int
+func ToBigInt(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value), true
+	default:
+		return nil, false
+	}
+}
+
+type Float struct {
+	Value float64
+}
+
+// Formats the shortest representation that reads back as the same value,
+// always marked as a float
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eInN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -75,11 +148,89 @@ func (rv *ReturnValue) Type() ObjectType {
 	return RETURN_VALUE_OBJ
 }
 
+// Signals a break statement out of the enclosing loop body
+type Break struct{}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+// Signals a continue statement out of the enclosing loop body
+type Continue struct{}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
+// Steps through the keys and values of an iterable object, as for-in loops
+// do in the virtual machine
+type Iterator struct {
+	// returns the next key and value, and false once there are none left
+	next func() (Object, Object, bool)
+	// whether a single loop variable takes the keys rather than the values
+	keyed bool
+}
+
+// Creates new iterator taking its keys and values from next. keyed tells
+// whether a single loop variable takes the keys rather than the values.
+func NewIterator(next func() (key, value Object, ok bool), keyed bool) *Iterator {
+	return &Iterator{next: next, keyed: keyed}
+}
+
+func (it *Iterator) Inspect() string {
+	return "iterator"
+}
+
+func (it *Iterator) Type() ObjectType {
+	return ITERATOR_OBJ
+}
+
+// Returns the next key and value, and false once there are none left
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// Reports whether a single loop variable takes the keys rather than the
+// values, as for hashes
+func (it *Iterator) Keyed() bool {
+	return it.keyed
+}
+
+// Variable of the virtual machine shared between the function declaring it
+// and the closures capturing it, so that they all see its assignments
+type Cell struct {
+	// nil while the variable is unbound
+	Value Object
+}
+
+func (c *Cell) Inspect() string {
+	return "cell"
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+
 type Error struct {
 	Message string
+	Code    string
+	Pos     token.Position
+	End     token.Position
+	Notes   []string
 }
 
 func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
 	return "ERROR: " + e.Message
 }
 
@@ -87,6 +238,17 @@ func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
 
+// Returns the error as a diagnostic for rendering
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	return &diagnostic.Diagnostic{
+		Severity: diagnostic.ERROR,
+		Code:     e.Code,
+		Span:     diagnostic.Span{Start: e.Pos, End: e.End},
+		Message:  e.Message,
+		Notes:    e.Notes,
+	}
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
@@ -132,6 +294,16 @@ type BuiltinFuncion func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFuncion
+	// used instead of Fn by builtins that need the host running them
+	HostFn func(host *Host, args ...Object) Object
+}
+
+// Calls the builtin on behalf of host, which may be nil
+func (b *Builtin) Call(host *Host, args ...Object) Object {
+	if b.HostFn != nil {
+		return b.HostFn(host, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -165,11 +337,43 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// Lazy sequence of integers from Start up to, but excluding, End
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Type() ObjectType {
+	return RANGE_OBJ
+}
+
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// Returns the number of integers in the range, which exceeds the int64
+// range for the widest ones. The distances are taken in uint64, where they
+// cannot overflow.
+func (r *Range) Len() uint64 {
+	if r.Step > 0 && r.Start < r.End {
+		return (uint64(r.End)-uint64(r.Start)-1)/uint64(r.Step) + 1
+	}
+	if r.Step < 0 && r.Start > r.End {
+		return (uint64(r.Start)-uint64(r.End)-1)/-uint64(r.Step) + 1
+	}
+	return 0
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
 
+// Type of the hash keys of big integers, kept apart from those of Integer
+// since the two never hold the same value
+const BIG_INTEGER_HASH_KEY = "BIG_INTEGER"
+
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 	if b.Value {
@@ -185,6 +389,25 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(bi.Value.String()))
+	return HashKey{Type: BIG_INTEGER_HASH_KEY, Value: h.Sum64()}
+}
+
+func (f *Float) HashKey() HashKey {
+	// integral floats hash like the integer they equal, so {1: "a"}[1.0]
+	// finds the pair
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+			return (&Integer{Value: int64(f.Value)}).HashKey()
+		}
+		integer, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInteger{Value: integer}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -222,3 +445,36 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	// names of the locals and free variables by index, for error messages
+	LocalNames []string
+	FreeNames  []string
+	// slots of the locals kept in cells, as they are captured by closures
+	Cells []int
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Closures are the functions of the virtual machine
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
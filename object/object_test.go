@@ -1,6 +1,10 @@
 package object
 
 import (
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -19,3 +23,290 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{2.5, "2.5"},
+		{2, "2.0"},
+		{-0.125, "-0.125"},
+		{1e21, "1e+21"},
+		{1.0 / 3, "0.3333333333333333"},
+	}
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %g. expected=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestBigIntegerNormalization(t *testing.T) {
+	small := NormalizeInteger(big.NewInt(42))
+	if _, ok := small.(*Integer); !ok {
+		t.Errorf("value fitting in int64 not demoted. got=%T", small)
+	}
+
+	huge, _ := new(big.Int).SetString("18446744073709551616", 10)
+	large := NormalizeInteger(huge)
+	if _, ok := large.(*BigInteger); !ok {
+		t.Fatalf("value overflowing int64 not promoted. got=%T", large)
+	}
+	if large.Type() != INTEGER_OBJ {
+		t.Errorf("big integer has wrong type. got=%s", large.Type())
+	}
+
+	same, _ := new(big.Int).SetString("18446744073709551616", 10)
+	other, _ := new(big.Int).SetString("18446744073709551617", 10)
+	if large.(*BigInteger).HashKey() != (&BigInteger{Value: same}).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if large.(*BigInteger).HashKey() == (&BigInteger{Value: other}).HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+}
+
+func TestRangeLen(t *testing.T) {
+	tests := []struct {
+		r        Range
+		expected uint64
+	}{
+		{Range{Start: 0, End: 10, Step: 3}, 4},
+		{Range{Start: 10, End: 0, Step: -3}, 4},
+		{Range{Start: 0, End: 0, Step: 1}, 0},
+		{Range{Start: 0, End: 10, Step: -1}, 0},
+		{Range{Start: -math.MaxInt64, End: math.MaxInt64, Step: 2}, math.MaxInt64},
+		{Range{Start: math.MinInt64, End: math.MaxInt64, Step: 1}, math.MaxUint64},
+		{Range{Start: math.MaxInt64, End: math.MinInt64, Step: math.MinInt64}, 2},
+		{Range{Start: math.MaxInt64, End: math.MinInt64, Step: -1}, math.MaxUint64},
+	}
+	for _, tt := range tests {
+		if n := tt.r.Len(); n != tt.expected {
+			t.Errorf("wrong length of %s. expected=%d, got=%d", tt.r.Inspect(), tt.expected, n)
+		}
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	huge, _ := new(big.Int).SetString("18446744073709551616", 10)
+	tests := []struct {
+		float *Float
+		equal Hashable
+	}{
+		{&Float{Value: 1}, &Integer{Value: 1}},
+		{&Float{Value: -3}, &Integer{Value: -3}},
+		{&Float{Value: math.Copysign(0, -1)}, &Integer{Value: 0}},
+		{&Float{Value: 18446744073709551616}, &BigInteger{Value: huge}},
+	}
+	for _, tt := range tests {
+		if tt.float.HashKey() != tt.equal.HashKey() {
+			t.Errorf("%s and %s have different hash keys", tt.float.Inspect(), tt.equal.(Object).Inspect())
+		}
+	}
+
+	if (&Float{Value: 1.5}).HashKey() == (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("b", &Integer{Value: 1})
+	outer.Set("a", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("c", &Integer{Value: 3})
+	inner.Set("a", &Integer{Value: 4})
+
+	names := inner.Names()
+	expected := []string{"a", "b", "c"}
+	if len(names) != len(expected) {
+		t.Fatalf("wrong names. expected=%v, got=%v", expected, names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Errorf("wrong names. expected=%v, got=%v", expected, names)
+		}
+	}
+}
+
+type testPoint struct {
+	X      int     `monkey:"x"`
+	Y      float64 `monkey:"y"`
+	Label  string
+	Hidden bool `monkey:"-"`
+	secret int
+}
+
+type testNode struct {
+	Value int
+	Next  *testNode
+}
+
+func cyclicList() any {
+	node := &testNode{Value: 1}
+	node.Next = &testNode{Value: 2, Next: node}
+	return node
+}
+
+func cyclicMap() any {
+	m := map[string]any{}
+	m["self"] = m
+	return m
+}
+
+func cyclicSlice() any {
+	s := []any{nil}
+	s[0] = s
+	return s
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{2.5, "2.5"},
+		{float32(0.5), "0.5"},
+		{"hi", "hi"},
+		{true, "true"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]any{1, "a", nil, []bool{false}}, "[1, a, null, [false]]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[int][]int{1: nil}, "{1: []}"},
+		{(*int)(nil), "null"},
+		{&testPoint{X: 1}, "{x: 1, y: 0.0, Label: }"},
+		{big.NewInt(-7), "-7"},
+		{&Integer{Value: 5}, "5"},
+	}
+	for _, tt := range tests {
+		obj, err := FromGo(tt.value)
+		if err != nil {
+			t.Errorf("FromGo(%#v) failed: %s", tt.value, err)
+			continue
+		}
+		if hash, ok := obj.(*Hash); ok && len(hash.Pairs) > 1 {
+			// hash pairs are inspected in no particular order
+			for _, part := range strings.Split(strings.Trim(tt.expected, "{}"), ", ") {
+				if !strings.Contains(obj.Inspect(), part) {
+					t.Errorf("FromGo(%#v) = %s, missing %q", tt.value, obj.Inspect(), part)
+				}
+			}
+			if len(hash.Pairs) != strings.Count(tt.expected, ":") {
+				t.Errorf("FromGo(%#v) = %s, expected %s", tt.value, obj.Inspect(), tt.expected)
+			}
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) = %s, expected %s", tt.value, obj.Inspect(), tt.expected)
+		}
+	}
+
+	unsupported := []struct {
+		value    any
+		expected string
+	}{
+		{make(chan int), "cannot convert Go value of type chan int"},
+		{[]any{1, func() {}}, "element 1: cannot convert Go value of type func()"},
+		{map[string]complex128{"z": 1i}, "value of z: cannot convert Go value of type complex128"},
+		{map[[1]int]int{{1}: 1}, "key [1]: unusable as hash key: ARRAY"},
+		{struct{ C chan int }{}, "field C: cannot convert Go value of type chan int"},
+		{cyclicList(), "field Next: field Next: cannot convert cyclic Go value of type *object.testNode"},
+		{cyclicMap(), "value of self: cannot convert cyclic Go value of type map[string]interface {}"},
+		{cyclicSlice(), "element 0: cannot convert cyclic Go value of type []interface {}"},
+	}
+	for _, tt := range unsupported {
+		_, err := FromGo(tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("FromGo(%T) wrong error. expected=%q, got=%v", tt.value, tt.expected, err)
+		}
+	}
+
+	// values referred to more than once without a cycle are converted
+	shared := []int{1}
+	n := 2
+	obj, err := FromGo([]any{shared, shared, &n, &n})
+	if err != nil || obj.Inspect() != "[[1], [1], 2, 2]" {
+		t.Errorf("shared values not converted. got=%v, %v", obj, err)
+	}
+}
+
+func TestToGo(t *testing.T) {
+	point, _ := FromGo(map[string]any{"x": 3, "y": 1.5, "Label": "p", "Hidden": true})
+	var p testPoint
+	if err := ToGo(point, &p); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	if (p != testPoint{X: 3, Y: 1.5, Label: "p"}) {
+		t.Errorf("wrong struct. got=%+v", p)
+	}
+
+	values, _ := FromGo([]any{1, 2.5, "s", true, nil, []int{1}, map[string]int{"k": 2}, map[int]int{1: 2}})
+	var natural any
+	if err := ToGo(values, &natural); err != nil {
+		t.Fatalf("ToGo failed: %s", err)
+	}
+	expected := []any{int64(1), 2.5, "s", true, nil, []any{int64(1)},
+		map[string]any{"k": int64(2)}, map[any]any{int64(1): int64(2)}}
+	if !reflect.DeepEqual(natural, expected) {
+		t.Errorf("wrong value. expected=%#v, got=%#v", expected, natural)
+	}
+
+	var ints []int
+	if err := ToGo(NULL, &ints); err != nil || ints != nil {
+		t.Errorf("null not converted to nil slice. got=%v, %v", ints, err)
+	}
+	var ptr *int
+	if err := ToGo(&Integer{Value: 4}, &ptr); err != nil || ptr == nil || *ptr != 4 {
+		t.Errorf("integer not converted to pointer. got=%v, %v", ptr, err)
+	}
+	var f float64
+	if err := ToGo(&Integer{Value: 4}, &f); err != nil || f != 4 {
+		t.Errorf("integer not converted to float. got=%v, %v", f, err)
+	}
+
+	natural = 1
+	if err := ToGo(nil, &natural); err != nil || natural != nil {
+		t.Errorf("nil object not converted to nil. got=%v, %v", natural, err)
+	}
+	if err := ToGo((*Integer)(nil), &ptr); err != nil || ptr != nil {
+		t.Errorf("nil integer not converted to nil pointer. got=%v, %v", ptr, err)
+	}
+	if err := ToGo(nil, new(int)); err == nil || err.Error() != "cannot convert NULL to int" {
+		t.Errorf("nil object converted to int. got=%v", err)
+	}
+
+	errors := []struct {
+		obj      Object
+		target   any
+		expected string
+	}{
+		{&String{Value: "a"}, new(int), "cannot convert STRING to int"},
+		{&Integer{Value: 300}, new(uint8), "300 out of range of uint8"},
+		{&Integer{Value: -1}, new(uint), "-1 out of range of uint"},
+		{&Array{Elements: []Object{TRUE, &Integer{Value: 1}}}, new([]bool), "element 1: cannot convert INTEGER to bool"},
+		{&Array{}, new([1]int), "cannot convert ARRAY of length 0 to [1]int"},
+		{point, new(map[string]string), "value of "},
+		{point, new(struct {
+			X string `monkey:"x"`
+		}), "field x: cannot convert INTEGER to string"},
+		{TRUE, new(chan int), "cannot convert to Go type chan int"},
+		{TRUE, 0, "cannot convert to int: target must be a non-nil pointer"},
+		{TRUE, (*int)(nil), "cannot convert to *int: target must be a non-nil pointer"},
+	}
+	for _, tt := range errors {
+		err := ToGo(tt.obj, tt.target)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("ToGo(%s, %T) wrong error. expected=%q, got=%v", tt.obj.Inspect(), tt.target, tt.expected, err)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/token"
 )
@@ -12,26 +16,51 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUALS
 	LESSGREATER
+	BITWISE_OR
+	BITWISE_XOR
+	BITWISE_AND
+	SHIFT
 	SUM
 	PRODUCT
 	PREFIX
+	POWER
 	CALL
 	INDEX
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.MODULO_ASSIGN:   ASSIGN,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.BIT_OR:          BITWISE_OR,
+	token.BIT_XOR:         BITWISE_XOR,
+	token.BIT_AND:         BITWISE_AND,
+	token.SHL:             SHIFT,
+	token.SHR:             SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.MODULO:          PRODUCT,
+	token.POWER:           POWER,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type Parser struct {
@@ -40,7 +69,15 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	errors []string
+	diagnostics []*diagnostic.Diagnostic
+	// number of lexer diagnostics already taken over into diagnostics
+	lexerDiagnostics int
+	// set after a syntax error until the parser resynchronises, so that a
+	// single mistake is reported only once
+	panicking bool
+
+	// number of loops enclosing the current token within the current function
+	loopDepth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -52,17 +89,18 @@ type (
 )
 
 func NewParser(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, diagnostics: []*diagnostic.Diagnostic{}}
 
-	p.curToken = l.GetToken()
+	p.curToken = p.readToken()
 
 	if p.curToken.Type != "EOF" {
-		p.peekToken = l.GetToken()
+		p.peekToken = p.readToken()
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.RegisterPrefix(token.IDENTIFIER, p.ParseIdentifier)
 	p.RegisterPrefix(token.INT, p.ParseIntegerLiteral)
+	p.RegisterPrefix(token.FLOAT, p.ParseFloatLiteral)
 	p.RegisterPrefix(token.BANG, p.ParsePrefixExpression)
 	p.RegisterPrefix(token.MINUS, p.ParsePrefixExpression)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -74,6 +112,18 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.RegisterInfix(token.NOT_EQ, p.ParseInfixExpression)
 	p.RegisterInfix(token.LT, p.ParseInfixExpression)
 	p.RegisterInfix(token.GT, p.ParseInfixExpression)
+	p.RegisterInfix(token.MODULO, p.ParseInfixExpression)
+	p.RegisterInfix(token.LT_EQ, p.ParseInfixExpression)
+	p.RegisterInfix(token.GT_EQ, p.ParseInfixExpression)
+	p.RegisterInfix(token.AND, p.ParseInfixExpression)
+	p.RegisterInfix(token.OR, p.ParseInfixExpression)
+	p.RegisterInfix(token.BIT_AND, p.ParseInfixExpression)
+	p.RegisterInfix(token.BIT_OR, p.ParseInfixExpression)
+	p.RegisterInfix(token.BIT_XOR, p.ParseInfixExpression)
+	p.RegisterInfix(token.SHL, p.ParseInfixExpression)
+	p.RegisterInfix(token.SHR, p.ParseInfixExpression)
+	p.RegisterInfix(token.POWER, p.ParseInfixExpression)
+	p.RegisterPrefix(token.BIT_NOT, p.ParsePrefixExpression)
 	p.RegisterPrefix(token.TRUE, p.ParseBoolean)
 	p.RegisterPrefix(token.FALSE, p.ParseBoolean)
 	p.RegisterPrefix(token.LPAREN, p.ParseGroupedExpression)
@@ -81,37 +131,86 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.RegisterPrefix(token.FUNCTION, p.ParseFunctionLiteral)
 	p.RegisterInfix(token.LPAREN, p.ParseCallExpression)
 	p.RegisterPrefix(token.STRING, p.ParseStringLiteral)
+	p.RegisterPrefix(token.STRING_START, p.ParseInterpolatedString)
 	p.RegisterPrefix(token.LBRACKET, p.ParseArrayLiteral)
 	p.RegisterInfix(token.LBRACKET, p.ParseIndexExpression)
 	p.RegisterPrefix(token.LBRACE, p.ParseHashLiteral)
+	p.RegisterInfix(token.ASSIGN, p.ParseAssignExpression)
+	p.RegisterInfix(token.PLUS_ASSIGN, p.ParseAssignExpression)
+	p.RegisterInfix(token.MINUS_ASSIGN, p.ParseAssignExpression)
+	p.RegisterInfix(token.ASTERISK_ASSIGN, p.ParseAssignExpression)
+	p.RegisterInfix(token.SLASH_ASSIGN, p.ParseAssignExpression)
+	p.RegisterInfix(token.MODULO_ASSIGN, p.ParseAssignExpression)
 
 	return p
 }
 
+// Returns the errors found while parsing, formatted as "position: message"
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, 0, len(p.diagnostics))
+	for _, d := range p.diagnostics {
+		errors = append(errors, d.String())
+	}
+	return errors
+}
+
+// Returns the errors found while parsing
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
+	return p.diagnostics
+}
+
+// Records an error covering tok. Errors raised while the parser is
+// recovering from an earlier one are dropped.
+func (p *Parser) errorAt(code string, tok token.Token, format string, a ...interface{}) *diagnostic.Diagnostic {
+	d := &diagnostic.Diagnostic{
+		Severity: diagnostic.ERROR,
+		Code:     code,
+		Span:     diagnostic.TokenSpan(tok),
+		Message:  fmt.Sprintf(format, a...),
+	}
+	if !p.panicking {
+		p.diagnostics = append(p.diagnostics, d)
+		p.panicking = true
+	}
+	return d
 }
 
 func (p *Parser) PeekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.errorAt(diagnostic.UNEXPECTED_TOKEN, p.peekToken,
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type)
+	if p.peekToken.Type == token.EOF {
+		d.Notes = append(d.Notes, "the input ended before the construct was complete")
+	}
 }
 
 func (p *Parser) NextToken() {
 	p.curToken = p.peekToken
 
 	if p.curToken.Type != "EOF" {
-		p.peekToken = p.l.GetToken()
+		p.peekToken = p.readToken()
 	}
 }
 
+// Reads the next token from the lexer, taking over the errors it found
+func (p *Parser) readToken() token.Token {
+	tok := p.l.GetToken()
+	lexerDiagnostics := p.l.Diagnostics()
+	p.diagnostics = append(p.diagnostics, lexerDiagnostics[p.lexerDiagnostics:]...)
+	p.lexerDiagnostics = len(lexerDiagnostics)
+	return tok
+}
+
+// Returns the comments skipped by the lexer, if it was asked to keep them
+func (p *Parser) Comments() []lexer.Comment {
+	return p.l.Comments()
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.ParseStatement()
+		stmt, _ := p.parseStatementWithRecovery()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -121,6 +220,37 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// Parses a statement and, if it contains a syntax error, skips ahead to the
+// next statement boundary. Returns nil and true for statements that failed to
+// parse. Errors inside nested blocks are recovered from by the block itself.
+func (p *Parser) parseStatementWithRecovery() (ast.Statement, bool) {
+	wasPanicking := p.panicking
+
+	stmt := p.ParseStatement()
+
+	if !wasPanicking && p.panicking {
+		p.synchronize()
+		return nil, true
+	}
+
+	return stmt, false
+}
+
+// Advances to the end of the current statement: a semicolon, or the token
+// before a closing brace or a keyword starting a statement.
+func (p *Parser) synchronize() {
+	for !p.CurTokenIs(token.SEMICOLON) && !p.CurTokenIs(token.RBRACE) && !p.CurTokenIs(token.EOF) {
+		if p.PeekTokenIs(token.LET) || p.PeekTokenIs(token.RETURN) ||
+			p.PeekTokenIs(token.WHILE) || p.PeekTokenIs(token.FOR) ||
+			p.PeekTokenIs(token.RBRACE) || p.PeekTokenIs(token.EOF) {
+			break
+		}
+		p.NextToken()
+	}
+
+	p.panicking = false
+}
+
 func (p *Parser) PeekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -136,14 +266,35 @@ func (p *Parser) CurPrecedence() int {
 }
 
 func (p *Parser) ParseStatement() ast.Statement {
+	// avoid wrapping nil pointers in a non-nil interface
 	switch p.curToken.Type {
 	case token.LET:
-		return p.ParseLetStatement()
+		if stmt := p.ParseLetStatement(); stmt != nil {
+			return stmt
+		}
 	case token.RETURN:
-		return p.ParseReturnStatement()
+		if stmt := p.ParseReturnStatement(); stmt != nil {
+			return stmt
+		}
+	case token.WHILE:
+		if stmt := p.ParseWhileStatement(); stmt != nil {
+			return stmt
+		}
+	case token.FOR:
+		if stmt := p.ParseForStatement(); stmt != nil {
+			return stmt
+		}
+	case token.BREAK, token.CONTINUE:
+		if stmt := p.ParseLoopControlStatement(); stmt != nil {
+			return stmt
+		}
 	default:
-		return p.ParseExpressionStatement()
+		if stmt := p.ParseExpressionStatement(); stmt != nil {
+			return stmt
+		}
 	}
+
+	return nil
 }
 
 func (p *Parser) ParseLetStatement() *ast.LetStatement {
@@ -162,6 +313,13 @@ func (p *Parser) ParseLetStatement() *ast.LetStatement {
 	p.NextToken()
 
 	stmt.Value = p.ParseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 
 	if p.PeekTokenIs(token.SEMICOLON) {
 		p.NextToken()
@@ -176,6 +334,86 @@ func (p *Parser) ParseReturnStatement() *ast.ReturnStatement {
 	p.NextToken()
 
 	stmt.ReturnValue = p.ParseExpression(LOWEST)
+	if stmt.ReturnValue == nil {
+		return nil
+	}
+
+	if p.PeekTokenIs(token.SEMICOLON) {
+		p.NextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) ParseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.ExpectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.NextToken()
+	stmt.Condition = p.ParseExpression(LOWEST)
+	if stmt.Condition == nil {
+		return nil
+	}
+
+	if !p.ExpectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.ExpectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.ParseLoopBody()
+
+	if p.PeekTokenIs(token.SEMICOLON) {
+		p.NextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) ParseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.ExpectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.ExpectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	stmt.Key = &ast.Identifier{Token: p.curToken, Value: string(p.curToken.Literal)}
+
+	if p.PeekTokenIs(token.COMMA) {
+		p.NextToken()
+		if !p.ExpectPeek(token.IDENTIFIER) {
+			return nil
+		}
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: string(p.curToken.Literal)}
+	}
+
+	if !p.ExpectPeek(token.IN) {
+		return nil
+	}
+
+	p.NextToken()
+	stmt.Iterable = p.ParseExpression(LOWEST)
+	if stmt.Iterable == nil {
+		return nil
+	}
+
+	if !p.ExpectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.ExpectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.ParseLoopBody()
 
 	if p.PeekTokenIs(token.SEMICOLON) {
 		p.NextToken()
@@ -184,6 +422,33 @@ func (p *Parser) ParseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// Parses the block of a loop, in which break and continue are allowed
+func (p *Parser) ParseLoopBody() *ast.BlockStatement {
+	p.loopDepth += 1
+	body := p.ParseBlockStatement()
+	p.loopDepth -= 1
+
+	return body
+}
+
+func (p *Parser) ParseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+
+	if p.loopDepth == 0 {
+		p.errorAt(diagnostic.OUTSIDE_LOOP, tok, "%s outside of a loop", string(tok.Literal))
+		return nil
+	}
+
+	if p.PeekTokenIs(token.SEMICOLON) {
+		p.NextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) CurTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -213,6 +478,9 @@ func (p *Parser) RegisterInfix(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) ParseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.ParseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
 
 	if p.PeekTokenIs(token.SEMICOLON) {
 		p.NextToken()
@@ -228,6 +496,9 @@ func (p *Parser) ParseExpression(precedence int) ast.Expression {
 		return nil
 	}
 	leftExp := prefix()
+	if leftExp == nil {
+		return nil
+	}
 
 	for !p.PeekTokenIs(token.SEMICOLON) && precedence < p.PeekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -238,6 +509,9 @@ func (p *Parser) ParseExpression(precedence int) ast.Expression {
 		p.NextToken()
 
 		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return nil
+		}
 	}
 
 	return leftExp
@@ -250,10 +524,37 @@ func (p *Parser) ParseIdentifier() ast.Expression {
 func (p *Parser) ParseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(string(p.curToken.Literal), 0, 64)
+	// the lexer has checked where underscores are placed
+	literal := strings.ReplaceAll(string(p.curToken.Literal), "_", "")
+	value, err := strconv.ParseInt(literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		d := p.errorAt(diagnostic.NUMBER_OUT_OF_RANGE, p.curToken,
+			"integer literal %s out of range: must be at most %d", p.curToken.Literal, int64(math.MaxInt64))
+		d.Hints = append(d.Hints, "larger integers can be computed, as in 2 ** 64")
+		return nil
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", string(p.curToken.Literal))
-		p.errors = append(p.errors, msg)
+		p.errorAt(diagnostic.INVALID_INTEGER, p.curToken, "could not parse %q as integer", string(p.curToken.Literal))
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) ParseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	literal := strings.ReplaceAll(string(p.curToken.Literal), "_", "")
+	value, err := strconv.ParseFloat(literal, 64)
+	if errors.Is(err, strconv.ErrRange) && math.IsInf(value, 0) {
+		p.errorAt(diagnostic.NUMBER_OUT_OF_RANGE, p.curToken,
+			"float literal %s out of range: must be at most %g", p.curToken.Literal, math.MaxFloat64)
+		return nil
+	}
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		p.errorAt(diagnostic.INVALID_NUMBER, p.curToken, "could not parse %q as float", string(p.curToken.Literal))
 		return nil
 	}
 
@@ -263,8 +564,10 @@ func (p *Parser) ParseIntegerLiteral() ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	d := p.errorAt(diagnostic.NO_PREFIX_PARSE, p.curToken, "no prefix parse function for %s found", t)
+	if t == token.SEMICOLON || t == token.EOF {
+		d.Hints = append(d.Hints, "an expression is missing here")
+	}
 }
 
 func (p *Parser) ParsePrefixExpression() ast.Expression {
@@ -274,6 +577,9 @@ func (p *Parser) ParsePrefixExpression() ast.Expression {
 	}
 	p.NextToken()
 	expression.Right = p.ParseExpression(PREFIX)
+	if expression.Right == nil {
+		return nil
+	}
 	return expression
 }
 
@@ -285,8 +591,39 @@ func (p *Parser) ParseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.CurPrecedence()
+	if p.CurTokenIs(token.POWER) {
+		// exponentiation is right associative: 2 ** 3 ** 2 == 2 ** (3 ** 2)
+		precedence--
+	}
 	p.NextToken()
 	expression.Right = p.ParseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) ParseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: string(p.curToken.Literal),
+		Target:   target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.errorAt(diagnostic.INVALID_ASSIGNMENT, p.curToken, "cannot assign to %s", target.String())
+		return nil
+	}
+
+	p.NextToken()
+	// assignment is right associative: a = b = c is a = (b = c)
+	expression.Value = p.ParseExpression(ASSIGN - 1)
+	if expression.Value == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -300,6 +637,9 @@ func (p *Parser) ParseGroupedExpression() ast.Expression {
 	p.NextToken()
 
 	exp := p.ParseExpression(LOWEST)
+	if exp == nil {
+		return nil
+	}
 
 	if !p.ExpectPeek(token.RPAREN) {
 		return nil
@@ -317,6 +657,9 @@ func (p *Parser) ParseIfExpression() ast.Expression {
 
 	p.NextToken()
 	expression.Condition = p.ParseExpression(LOWEST)
+	if expression.Condition == nil {
+		return nil
+	}
 
 	if !p.ExpectPeek(token.RPAREN) {
 		return nil
@@ -348,10 +691,14 @@ func (p *Parser) ParseBlockStatement() *ast.BlockStatement {
 	p.NextToken()
 
 	for !p.CurTokenIs(token.RBRACE) && !p.CurTokenIs(token.EOF) {
-		stmt := p.ParseStatement()
+		stmt, recovered := p.parseStatementWithRecovery()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if recovered && p.CurTokenIs(token.RBRACE) {
+			// the erroneous statement ran into the closing brace of this block
+			break
+		}
 		p.NextToken()
 	}
 
@@ -371,7 +718,11 @@ func (p *Parser) ParseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// loops around the literal do not extend into its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.ParseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
@@ -405,6 +756,9 @@ func (p *Parser) ParseFunctionParameters() []*ast.Identifier {
 func (p *Parser) ParseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.ParseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
 	return exp
 }
 
@@ -412,10 +766,46 @@ func (p *Parser) ParseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: string(p.curToken.Literal)}
 }
 
+func (p *Parser) ParseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for {
+		str.Parts = append(str.Parts, p.ParseStringLiteral())
+		if p.CurTokenIs(token.STRING_END) {
+			return str
+		}
+
+		if p.PeekTokenIs(token.STRING_MIDDLE) || p.PeekTokenIs(token.STRING_END) {
+			p.errorAt(diagnostic.EMPTY_INTERPOLATION, p.peekToken, "empty embedded expression in string")
+			return nil
+		}
+
+		p.NextToken()
+		exp := p.ParseExpression(LOWEST)
+		if exp == nil {
+			return nil
+		}
+		str.Parts = append(str.Parts, exp)
+
+		if !p.PeekTokenIs(token.STRING_MIDDLE) && !p.PeekTokenIs(token.STRING_END) {
+			d := p.errorAt(diagnostic.UNEXPECTED_TOKEN, p.peekToken,
+				"expected } after embedded expression, got %s instead", p.peekToken.Type)
+			if p.peekToken.Type == token.EOF {
+				d.Notes = append(d.Notes, "the input ended before the construct was complete")
+			}
+			return nil
+		}
+		p.NextToken()
+	}
+}
+
 func (p *Parser) ParseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.ParseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
 
 	return array
 }
@@ -437,6 +827,12 @@ func (p *Parser) ParseExpressionList(end token.TokenType) []ast.Expression {
 		list = append(list, p.ParseExpression(LOWEST))
 	}
 
+	for _, exp := range list {
+		if exp == nil {
+			return nil
+		}
+	}
+
 	if !p.ExpectPeek(end) {
 		return nil
 	}
@@ -449,6 +845,9 @@ func (p *Parser) ParseIndexExpression(left ast.Expression) ast.Expression {
 
 	p.NextToken()
 	exp.Index = p.ParseExpression(LOWEST)
+	if exp.Index == nil {
+		return nil
+	}
 
 	if !p.ExpectPeek(token.RBRACKET) {
 		return nil
@@ -464,12 +863,18 @@ func (p *Parser) ParseHashLiteral() ast.Expression {
 	for !p.PeekTokenIs(token.RBRACE) {
 		p.NextToken()
 		key := p.ParseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
 
 		if !p.ExpectPeek(token.COLON) {
 			return nil
 		}
 		p.NextToken()
 		value := p.ParseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
 		hash.Pairs[key] = value
 
 		if !p.PeekTokenIs(token.RBRACE) && !p.ExpectPeek(token.COMMA) {
@@ -2,9 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 )
 
@@ -162,6 +166,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~5;", "~", 5},
 	}
 	for _, tt := range prefixTests {
 		l := lexer.NewLexer([]byte(tt.input))
@@ -224,6 +229,17 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 && 5;", 5, "&&", 5},
+		{"5 || 5;", 5, "||", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"5 ** 5;", 5, "**", 5},
 	}
 	for _, tt := range infixTests {
 		l := lexer.NewLexer([]byte(tt.input))
@@ -333,6 +349,54 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a < b == c >= d",
+			"((a < b) == (c >= d))",
+		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"a << b + c & d",
+			"((a << (b + c)) & d)",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a ** -b * c",
+			"((a ** (-b)) * c)",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.NewLexer([]byte(tt.input))
@@ -743,3 +807,459 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 5;\nlet = 10;", "2:5: expected next token to be IDENTIFIER, got = instead"},
+		{"let x = 5;\n  ;", "2:3: no prefix parse function for ; found"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer([]byte(tt.input))
+		p := NewParser(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "let x = 1;\nx + add(2, 3);"
+	l := lexer.NewLexer([]byte(input))
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	infix, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.InfixExpression. got=%T", stmt.Expression)
+	}
+	if pos := infix.Left.Pos(); pos.Line != 2 || pos.Column != 1 {
+		t.Errorf("infix.Left position wrong. got=%d:%d", pos.Line, pos.Column)
+	}
+	if pos := infix.Pos(); pos.Line != 2 || pos.Column != 3 {
+		t.Errorf("infix position wrong. got=%d:%d", pos.Line, pos.Column)
+	}
+	call := infix.Right.(*ast.CallExpression)
+	if pos := call.Arguments[1].Pos(); pos.Line != 2 || pos.Column != 12 {
+		t.Errorf("argument position wrong. got=%d:%d", pos.Line, pos.Column)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `
+let x 5;
+let y = 10;
+let = 3;
+return (1 + 2;
+let f = fn(a) {
+  let b = ;
+  a + 1
+};
+f(y);
+`
+	l := lexer.NewLexer([]byte(input))
+	p := NewParser(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"2:7: expected next token to be =, got INT instead",
+		"4:5: expected next token to be IDENTIFIER, got = instead",
+		"5:14: expected next token to be ), got ; instead",
+		"7:11: no prefix parse function for ; found",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d (%q)",
+			len(expectedErrors), len(errors), errors)
+	}
+	for i, expected := range expectedErrors {
+		if errors[i] != expected {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, expected, errors[i])
+		}
+	}
+
+	expectedStatements := []string{
+		"let y = 10;",
+		"let f = fn(a) (a + 1);",
+		"f(y)",
+	}
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf("wrong number of statements. expected=%d, got=%d (%q)",
+			len(expectedStatements), len(program.Statements), program.String())
+	}
+	for i, expected := range expectedStatements {
+		if program.Statements[i].String() != expected {
+			t.Errorf("statements[%d] wrong. expected=%q, got=%q",
+				i, expected, program.Statements[i].String())
+		}
+	}
+}
+
+func TestErrorRecoveryAtClosingBrace(t *testing.T) {
+	input := "let f = fn() { let a = }; let g = 1;"
+	l := lexer.NewLexer([]byte(input))
+	p := NewParser(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got=%d (%q)", len(p.Errors()), p.Errors())
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d (%q)",
+			len(program.Statements), program.String())
+	}
+	if program.Statements[1].String() != "let g = 1;" {
+		t.Errorf("statements[1] wrong. got=%q", program.Statements[1].String())
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x }", "while(x < 10) x"},
+		{"for (x in xs) { x };", "for (x in xs) x"},
+		{"for (k, v in h) { k }", "for (k, v in h) k"},
+		{"while (true) { break; continue }", "whiletrue break;continue;"},
+		{"for (x in xs) { fn() { x } }", "for (x in xs) fn() x"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer([]byte(tt.input))
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"while (true) { fn() { continue; } }", "1:23: continue outside of a loop"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer([]byte(tt.input))
+		p := NewParser(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 error for %q. got=%q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "(x = 5)"},
+		{"x += 1 + 2;", "(x += (1 + 2))"},
+		{"x = y = z;", "(x = (y = z))"},
+		{"a[0] -= 1;", "((a[0]) -= 1)"},
+		{"h[\"k\"] = v * 2;", "((h[k]) = (v * 2))"},
+		{"x %= 3", "(x %= 3)"},
+		{"x /= y == z", "(x /= (y == z))"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer([]byte(tt.input))
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.NewLexer([]byte("1 + x = 5;"))
+	p := NewParser(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "1:7: cannot assign to (1 + x)" {
+		t.Errorf("wrong errors for invalid target. got=%q", errors)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.25;"
+	l := lexer.NewLexer([]byte(input))
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %g. got=%g", 3.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.25", literal.TokenLiteral())
+	}
+}
+
+func TestNumberLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0xFF", int64(255)},
+		{"0Xff", int64(255)},
+		{"0o755", int64(493)},
+		{"0b1010", int64(10)},
+		{"1_000_000", int64(1000000)},
+		{"0x_dead_beef", int64(0xdeadbeef)},
+		{"9223372036854775807", int64(math.MaxInt64)},
+		{"1.5e-3", 0.0015},
+		{"2E10", 2e10},
+		{"1_000.000_5", 1000.0005},
+		{"1e-400", 0.0},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer([]byte(tt.input)))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		switch expected := tt.expected.(type) {
+		case int64:
+			literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+			if !ok {
+				t.Fatalf("%q: exp not *ast.IntegerLiteral. got=%T", tt.input, stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("%q: literal.Value not %d. got=%d", tt.input, expected, literal.Value)
+			}
+		case float64:
+			literal, ok := stmt.Expression.(*ast.FloatLiteral)
+			if !ok {
+				t.Fatalf("%q: exp not *ast.FloatLiteral. got=%T", tt.input, stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("%q: literal.Value not %g. got=%g", tt.input, expected, literal.Value)
+			}
+		}
+	}
+}
+
+func TestNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let x = 9223372036854775808;", "1:9: integer literal 9223372036854775808 out of range: must be at most 9223372036854775807"},
+		{"x + 0xFFFF_FFFF_FFFF_FFFF", "1:5: integer literal 0xFFFF_FFFF_FFFF_FFFF out of range: must be at most 9223372036854775807"},
+		{"1e400", "1:1: float literal 1e400 out of range: must be at most 1.7976931348623157e+308"},
+		{"0b102", "1:5: invalid digit '2' in binary literal"},
+		{"0x;", "1:1: hexadecimal literal has no digits"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer([]byte(tt.input)))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// adds two numbers
+let add = fn(a, b) {
+  a + /* inline */ b // trailing
+};
+/* add(1, 2) */`
+
+	l := lexer.NewLexer([]byte(input))
+	l.KeepComments()
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "let add = fn(a, b) (a + b);" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	expected := []string{"// adds two numbers", "/* inline */", "// trailing", "/* add(1, 2) */"}
+	comments := p.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(comments))
+	}
+	for i, text := range expected {
+		if string(comments[i].Text) != text {
+			t.Errorf("comments[%d] wrong. expected=%q, got=%q", i, text, comments[i].Text)
+		}
+	}
+}
+
+func TestUnterminatedBlockCommentError(t *testing.T) {
+	l := lexer.NewLexer([]byte("let a = 1;\n/* never closed\nlet b = 2;"))
+	p := NewParser(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. expected=1, got=%d: %q", len(errors), errors)
+	}
+	if errors[0] != "2:1: unterminated block comment" {
+		t.Errorf("wrong error. got=%q", errors[0])
+	}
+	if p.Diagnostics()[0].Code != diagnostic.UNTERMINATED_COMMENT {
+		t.Errorf("wrong code. got=%q", p.Diagnostics()[0].Code)
+	}
+}
+
+func TestParsingFromReader(t *testing.T) {
+	input := "let add = fn(a, b) {\r\n\treturn a + b;\r\n};\r\nadd(1, 2);\r\n"
+
+	l := lexer.NewReaderLexer("add.monkey", iotest.OneByteReader(strings.NewReader(input)))
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "let add = fn(a, b) return (a + b);;add(1, 2)" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+	if pos := program.Statements[1].Pos(); pos.String() != "add.monkey:4:1" {
+		t.Errorf("wrong position of second statement. got=%s", pos)
+	}
+}
+
+func TestIncompleteExpressionsAreDropped(t *testing.T) {
+	tests := []string{
+		"fn = 1",
+		"[ += ]",
+		"[1, += ]",
+		"f( += )",
+		"{ += : 1 }",
+		"{ 1 : += }",
+		"a[ += ]",
+		"( += )",
+		"if ( += ) { 1 }",
+		"while ( += ) { 1 }",
+		"for (x in += ) { 1 }",
+		"-( += )",
+		"1 + ( += )",
+		"fn + 1",
+	}
+	for _, input := range tests {
+		p := NewParser(lexer.NewLexer([]byte(input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+		// malformed expressions must not leave nil nodes behind
+		_ = program.String()
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"Hello ${name}, you are ${age + 1}"`, `"Hello ${name}, you are ${(age + 1)}"`, 5},
+		{`"${a}"`, `"${a}"`, 3},
+		{`"${h["key"]}!"`, `"${(h[key])}!"`, 3},
+		{`"a ${"b ${c} d"} e"`, `"a ${"b ${c} d"} e"`, 3},
+		{`"${fn(x) { x }(1)}"`, `"${fn(x) x(1)}"`, 3},
+		{`"${ {"k": 1}["k"] }"`, `"${({k: 1}[k])}"`, 3},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer([]byte(tt.input)))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("%q: exp not *ast.InterpolatedString. got=%T", tt.input, stmt.Expression)
+		}
+		if len(str.Parts) != tt.parts {
+			t.Errorf("%q: wrong number of parts. expected=%d, got=%d", tt.input, tt.parts, len(str.Parts))
+		}
+		if str.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, str.String())
+		}
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"a ${} b"`, "1:6: empty embedded expression in string"},
+		{`"a ${x y} b"`, "1:8: expected } after embedded expression, got IDENTIFIER instead"},
+		{`"a ${x`, "1:7: expected } after embedded expression, got EOF instead"},
+		{"\"a ${x} b\nlet c = 1;", "1:7: unterminated string literal"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer([]byte(tt.input)))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let s = \"abc;\nlet b = 1;", "1:9: unterminated string literal"},
+		{`let s = "a\qb";`, `1:11: invalid escape sequence \q`},
+		{"let s = `abc;\nlet b = 1;", "1:9: unterminated raw string literal"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer([]byte(tt.input)))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expectedError, errors[0])
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"interpreter/ast"
+	"interpreter/diagnostic"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/token"
+)
+
+// Command entered with a leading colon
+type command struct {
+	name string
+	// argument shown in the help, empty if the command takes none
+	argument    string
+	description string
+	run         func(s *session, arg string)
+}
+
+var commands []command
+
+func init() {
+	// assigned here as :help refers to the list
+	commands = []command{
+		{"help", "", "show this help", (*session).help},
+		{"env", "", "list the names bound in the session", (*session).listEnvironment},
+		{"reset", "", "forget all bindings and the transcript", (*session).reset},
+		{"load", "<file>", "evaluate a script file in the session", (*session).load},
+		{"save", "<file>", "write the code entered so far, with its output, to a file", (*session).save},
+		{"ast", "<expr>", "print the syntax tree of the code", (*session).printAST},
+		{"tokens", "<expr>", "print the tokens of the code", (*session).printTokens},
+		{"type", "<expr>", "evaluate the code and print the type of its value", (*session).printType},
+		{"time", "<expr>", "evaluate the code and print how long it took", (*session).time},
+	}
+}
+
+// Runs a line starting with a colon
+func (s *session) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if c.argument != "" && arg == "" {
+			fmt.Fprintf(s.out, "usage: :%s %s\n", c.name, c.argument)
+			return
+		}
+		c.run(s, arg)
+		return
+	}
+	fmt.Fprintf(s.out, "unknown command :%s, see :help\n", name)
+}
+
+func (s *session) help(string) {
+	for _, c := range commands {
+		usage := ":" + c.name
+		if c.argument != "" {
+			usage += " " + c.argument
+		}
+		fmt.Fprintf(s.out, "  %-15s %s\n", usage, c.description)
+	}
+	fmt.Fprintf(s.out, "  %-15s %s\n", "exit", "end the session")
+}
+
+func (s *session) listEnvironment(string) {
+	names := s.env.Names()
+	if len(names) == 0 {
+		fmt.Fprintln(s.out, "no bindings")
+		return
+	}
+	for _, name := range names {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+	}
+}
+
+func (s *session) reset(string) {
+	s.env = object.NewEnvironment()
+	s.transcript.Reset()
+	fmt.Fprintln(s.out, "session reset")
+}
+
+func (s *session) load(path string) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "could not read %s: %s\n", path, err)
+		return
+	}
+	s.record(strings.TrimSuffix(string(input), "\n"), s.eval(path, input))
+}
+
+func (s *session) save(path string) {
+	if err := os.WriteFile(path, []byte(s.transcript.String()), 0o644); err != nil {
+		fmt.Fprintf(s.out, "could not write %s: %s\n", path, err)
+		return
+	}
+	fmt.Fprintf(s.out, "saved session to %s\n", path)
+}
+
+func (s *session) printAST(code string) {
+	program, ok := s.parse(s.out, "", []byte(code))
+	if !ok {
+		return
+	}
+	ast.Fprint(s.out, program)
+}
+
+func (s *session) printTokens(code string) {
+	l := lexer.NewLexer([]byte(code))
+	for tok := l.GetToken(); tok.Type != token.EOF; tok = l.GetToken() {
+		fmt.Fprintf(s.out, "%-6s %-13s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+	diagnostic.Render(s.out, []byte(code), l.Diagnostics())
+}
+
+func (s *session) printType(code string) {
+	program, ok := s.parse(s.out, "", []byte(code))
+	if !ok {
+		return
+	}
+	evaluated := safeEval(program, s.env)
+	if evaluated == nil {
+		fmt.Fprintln(s.out, "no value")
+		return
+	}
+	if evaluated.Type() == object.ERROR_OBJ {
+		fmt.Fprintln(s.out, evaluated.Inspect())
+		return
+	}
+	fmt.Fprintln(s.out, evaluated.Type())
+}
+
+func (s *session) time(code string) {
+	start := time.Now()
+	output := s.eval("", []byte(code))
+	elapsed := time.Since(start)
+
+	s.record(code, output)
+	fmt.Fprintf(s.out, "took %s\n", elapsed)
+}
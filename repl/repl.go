@@ -1,57 +1,231 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/evaluator"
 	"interpreter/lexer"
+	"interpreter/lineedit"
 	"interpreter/object"
 	"interpreter/parser"
+	"interpreter/token"
 )
 
 const (
 	PROMPT = ">> "
+	// shown while the input read so far is incomplete
+	CONTINUATION_PROMPT = ".. "
+	// kept in the home directory
+	HISTORY_FILE = ".monkey_history"
 )
 
+// Tokens after which an expression or statement must continue
+var continuingTokens = map[token.TokenType]bool{
+	token.ASSIGN:          true,
+	token.PLUS:            true,
+	token.MINUS:           true,
+	token.ASTERISK:        true,
+	token.SLASH:           true,
+	token.MODULO:          true,
+	token.BANG:            true,
+	token.LT:              true,
+	token.GT:              true,
+	token.EQ:              true,
+	token.NOT_EQ:          true,
+	token.LT_EQ:           true,
+	token.GT_EQ:           true,
+	token.AND:             true,
+	token.OR:              true,
+	token.BIT_AND:         true,
+	token.BIT_OR:          true,
+	token.BIT_XOR:         true,
+	token.BIT_NOT:         true,
+	token.SHL:             true,
+	token.SHR:             true,
+	token.POWER:           true,
+	token.PLUS_ASSIGN:     true,
+	token.MINUS_ASSIGN:    true,
+	token.ASTERISK_ASSIGN: true,
+	token.SLASH_ASSIGN:    true,
+	token.MODULO_ASSIGN:   true,
+	token.COMMA:           true,
+	token.COLON:           true,
+	token.ELSE:            true,
+}
+
+// State of an interactive session
+type session struct {
+	out io.Writer
+	env *object.Environment
+	// code entered so far, each chunk followed by its output in comments
+	transcript strings.Builder
+}
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	editor := lineedit.New(in, out)
+	s := &session{out: out, env: object.NewEnvironment()}
+	editor.Complete = s.complete
+	if editor.Terminal() {
+		if home, err := os.UserHomeDir(); err == nil {
+			editor.LoadHistory(filepath.Join(home, HISTORY_FILE))
+		}
+	}
+
 	for {
-		fmt.Print(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := editor.ReadLine(PROMPT)
+		if err == lineedit.ErrInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
-
-		line := scanner.Text()
+		editor.AddHistory(line)
 
 		if line == "exit" {
-			fmt.Println("Goodbye!")
+			fmt.Fprintln(out, "Goodbye!")
 			return
 		}
 
-		l := lexer.NewLexer([]byte(line))
-		p := parser.NewParser(l)
-
-		program := p.ParseProgram()
+		if strings.HasPrefix(strings.TrimSpace(line), ":") {
+			s.command(strings.TrimSpace(line))
+			continue
+		}
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		// keep reading lines until the input is complete; an empty line
+		// gives up and evaluates what was entered so far, and Ctrl-C drops it
+		input := line
+		for err == nil && isIncomplete([]byte(input)) {
+			line, err = editor.ReadLine(CONTINUATION_PROMPT)
+			if err != nil || strings.TrimSpace(line) == "" {
+				break
+			}
+			editor.AddHistory(line)
+			input += "\n" + line
+		}
+		if err == lineedit.ErrInterrupted {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		s.record(input, s.eval("", []byte(input)))
+	}
+}
+
+// Returns the keywords, builtins, bound names and commands starting with
+// word, for tab completion
+func (s *session) complete(word string) []string {
+	var names []string
+	if strings.HasPrefix(word, ":") {
+		for _, c := range commands {
+			names = append(names, ":"+c.name)
+		}
+	} else {
+		names = append(names, token.Keywords()...)
+		names = append(names, evaluator.BuiltinNames()...)
+		names = append(names, s.env.Names()...)
+	}
+
+	seen := make(map[string]bool)
+	matches := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// Parses and evaluates input in the session environment, printing the
+// result or the diagnostics found, and returns what was printed
+func (s *session) eval(filename string, input []byte) string {
+	var out strings.Builder
+
+	program, ok := s.parse(&out, filename, input)
+	if ok {
+		evaluated := safeEval(program, s.env)
 		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+			out.WriteString(evaluated.Inspect())
+			out.WriteString("\n")
+		}
+	}
+
+	io.WriteString(s.out, out.String())
+	return out.String()
+}
+
+// Parses input, rendering the diagnostics found to out. Reports false if
+// there were errors.
+func (s *session) parse(out io.Writer, filename string, input []byte) (*ast.Program, bool) {
+	p := parser.NewParser(lexer.NewFileLexer(filename, input))
+	program := p.ParseProgram()
+
+	if len(p.Diagnostics()) != 0 {
+		diagnostic.Render(out, input, p.Diagnostics())
+		return nil, false
+	}
+	return program, true
+}
+
+// Adds code and the output it gave to the transcript
+func (s *session) record(code string, output string) {
+	s.transcript.WriteString(code)
+	s.transcript.WriteString("\n")
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		if line != "" {
+			s.transcript.WriteString("// " + line + "\n")
 		}
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// Reports whether input ends before a construct is complete: inside
+// parentheses, brackets, braces, an embedded expression, a raw string or a
+// block comment, or after an operator
+func isIncomplete(input []byte) bool {
+	l := lexer.NewLexer(input)
+
+	depth := 0
+	var last token.Token
+	for tok := l.GetToken(); tok.Type != token.EOF; tok = l.GetToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE, token.STRING_START:
+			depth += 1
+		case token.RPAREN, token.RBRACKET, token.RBRACE, token.STRING_END:
+			depth -= 1
+		}
+		last = tok
+	}
+
+	for _, d := range l.Diagnostics() {
+		switch d.Code {
+		case diagnostic.UNTERMINATED_COMMENT:
+			return true
+		case diagnostic.UNTERMINATED_STRING:
+			// only raw strings may span several lines
+			if input[d.Span.Start.Offset] == '`' {
+				return true
+			}
+		}
 	}
+
+	return depth > 0 || continuingTokens[last.Type]
+}
+
+// Evaluates program, turning a Go panic into an error so that a bug in the
+// interpreter does not end the session
+func safeEval(program *ast.Program, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = evaluator.InternalError(r)
+		}
+	}()
+
+	return evaluator.Eval(program, env)
 }
@@ -0,0 +1,175 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"interpreter/object"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) {\n  a + b\n}", false},
+		{"[1, 2,", true},
+		{"{\"a\": 1,\n\"b\":", true},
+		{"add(1,\n2", true},
+		{"1 +", true},
+		{"let x =", true},
+		{"true &&", true},
+		{"if (x) { 1 } else", true},
+		{"x += ", true},
+		{"`raw", true},
+		{"`raw\nstring`", false},
+		{"\"open", false},
+		{"\"a ${f(", true},
+		{"\"a ${f(1)} b\"", false},
+		{"/* comment", true},
+		{"1 /* comment */", false},
+		{")", false},
+		{"}", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete([]byte(tt.input)); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1,
+  2)
+let h = {
+  "one": 1,
+  "two": 2
+}
+h["two"]
+[1, 2
+
+exit
+`
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	// let statements print nothing
+	expected := ">> .. .. >> .. 3\n>> .. .. .. >> 2\n>> .. 1:6: error[P001]: expected next token to be ], got EOF instead\n"
+	got := out.String()
+	if !strings.HasPrefix(got, expected) {
+		t.Errorf("wrong output. expected prefix=%q, got=%q", expected, got)
+	}
+	if !strings.HasSuffix(got, ">> Goodbye!\n") {
+		t.Errorf("session did not end on exit. got=%q", got)
+	}
+}
+
+// Runs a session on input and returns its output
+func runSession(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	return out.String()
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":env", ">> no bindings\n"},
+		{"let b = 2;\nlet a = [1];\n:env", ">> >> >> a = [1]\nb = 2\n"},
+		{"let a = 1;\n:reset\n:env\na", ">> >> session reset\n>> no bindings\n>> ERROR: 1:1: identifier not found: a\n"},
+		{":ast -x", ">> Program 1:1\n  Statements[0]: ExpressionStatement 1:1\n    Expression: PrefixExpression 1:1 Operator=\"-\"\n      Right: Identifier 1:2 Value=\"x\"\n"},
+		{":ast (", ">> 1:2: error[P002]: no prefix parse function for EOF found\n"},
+		{":tokens a[0]", ">> 1:1    IDENTIFIER    \"a\"\n1:2    [             \"[\"\n1:3    INT           \"0\"\n1:4    ]             \"]\"\n"},
+		{":type 1.5", ">> FLOAT\n"},
+		{":type fn() {}", ">> FUNCTION\n"},
+		{":type let x = 1", ">> no value\n"},
+		{":type x", ">> ERROR: 1:1: identifier not found: x\n"},
+		{":ast", ">> usage: :ast <expr>\n"},
+		{":frobnicate", ">> unknown command :frobnicate, see :help\n"},
+	}
+
+	for _, tt := range tests {
+		got := runSession(tt.input + "\n")
+		if !strings.HasPrefix(got, tt.expected) {
+			t.Errorf("%q: wrong output. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	got := runSession(":help\n")
+	for _, c := range commands {
+		if !strings.Contains(got, ":"+c.name) {
+			t.Errorf(":help does not list :%s. got=%q", c.name, got)
+		}
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	got := runSession(":time 2 ** 10\n")
+	if !strings.HasPrefix(got, ">> 1024\ntook ") {
+		t.Errorf("wrong output. got=%q", got)
+	}
+}
+
+func TestSaveAndLoadCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.monkey")
+
+	got := runSession("let double = fn(x) {\n  x * 2\n};\ndouble(21)\n:save " + path + "\n")
+	if !strings.HasSuffix(got, "saved session to "+path+"\n>> ") {
+		t.Errorf("wrong output. got=%q", got)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read saved session: %s", err)
+	}
+	expected := "let double = fn(x) {\n  x * 2\n};\ndouble(21)\n// 42\n"
+	if string(saved) != expected {
+		t.Errorf("wrong transcript. expected=%q, got=%q", expected, saved)
+	}
+
+	got = runSession(":load " + path + "\ndouble(4)\n")
+	if got != ">> 42\n>> 8\n>> " {
+		t.Errorf("wrong output. got=%q", got)
+	}
+
+	got = runSession(":load " + filepath.Join(t.TempDir(), "missing.monkey") + "\n")
+	if !strings.HasPrefix(got, ">> could not read ") {
+		t.Errorf("wrong output. got=%q", got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := &session{out: &bytes.Buffer{}, env: object.NewEnvironment()}
+	s.env.Set("length_of_list", &object.Integer{Value: 1})
+	s.env.Set("lettuce", &object.Integer{Value: 2})
+
+	tests := []struct {
+		word     string
+		expected []string
+	}{
+		{"le", []string{"len", "length_of_list", "let", "lettuce"}},
+		{"pri", []string{"print"}},
+		{"wh", []string{"while"}},
+		{":t", []string{":time", ":tokens", ":type"}},
+		{"zz", []string{}},
+	}
+	for _, tt := range tests {
+		got := s.complete(tt.word)
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("%q: wrong completions. expected=%v, got=%v", tt.word, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,600 @@
+package vm
+
+import (
+	"fmt"
+
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+}
+
+type VM struct {
+	constants   []object.Object
+	globalNames []string
+	builtins    []*object.Builtin
+
+	stack []object.Object
+	sp    int // always points to the next free slot, top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	// value the program evaluated to
+	result object.Object
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	builtins := []*object.Builtin{}
+	for _, name := range evaluator.BuiltinNames() {
+		builtin, _ := evaluator.LookupBuiltin(name)
+		builtins = append(builtins, builtin)
+	}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globalNames: bytecode.GlobalNames,
+		builtins:    builtins,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// Creates a VM that shares globals with an earlier run, as needed by the REPL
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// Returns the value of the last statement executed, which is nil unless it is
+// an expression statement, the value of a top-level return, or the runtime
+// error that stopped the program
+func (vm *VM) Result() object.Object {
+	return vm.result
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex += 1
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex -= 1
+	return vm.frames[vm.framesIndex]
+}
+
+// Executes the bytecode. Runtime errors of the program are reported through
+// Result as error objects; the returned error is only set when the VM itself
+// fails, for example on stack overflow.
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip += 1
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var result object.Object
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.result = vm.pop()
+
+		case code.OpTrue:
+			err := vm.push(evaluator.TRUE)
+			if err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			err := vm.push(evaluator.FALSE)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			err := vm.push(evaluator.NULL)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNone:
+			// the missing value of statements, which the evaluator reports as nil
+			err := vm.push(nil)
+			if err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			right := vm.pop()
+			left := vm.pop()
+			result = evaluator.EvalInfix(infixOperators[op], left, right)
+
+		case code.OpMinus:
+			result = evaluator.EvalPrefix("-", vm.pop())
+
+		case code.OpBang:
+			result = evaluator.EvalPrefix("!", vm.pop())
+
+		case code.OpBitNot:
+			result = evaluator.EvalPrefix("~", vm.pop())
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !evaluator.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpIterator:
+			result = evaluator.Iterate(vm.pop())
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numVars := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.iterNext(vm.pop().(*object.Iterator), int(numVars), pos)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			result = vm.globals[globalIndex]
+			if result == nil {
+				result = unboundError(vm.globalNames, int(globalIndex))
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			result = vm.stack[frame.basePointer+int(localIndex)]
+			if result == nil {
+				result = unboundError(frame.cl.Fn.LocalNames, int(localIndex))
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			result = vm.builtins[builtinIndex]
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			result = currentClosure.Free[freeIndex]
+			if result == nil {
+				result = unboundError(currentClosure.Fn.FreeNames, int(freeIndex))
+			}
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			result = vm.stack[frame.basePointer+int(localIndex)].(*object.Cell).Value
+			if result == nil {
+				result = unboundError(frame.cl.Fn.LocalNames, int(localIndex))
+			}
+
+		case code.OpSetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)].(*object.Cell).Value = vm.pop()
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			result = currentClosure.Free[freeIndex].(*object.Cell).Value
+			if result == nil {
+				result = unboundError(currentClosure.Fn.FreeNames, int(freeIndex))
+			}
+
+		case code.OpAssignGlobal:
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
+			operator := code.Opcode(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			result = vm.assign(&vm.globals[globalIndex], vm.globalNames, globalIndex, operator)
+
+		case code.OpAssignLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			operator := code.Opcode(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+localIndex]
+			result = vm.assign(slot, frame.cl.Fn.LocalNames, localIndex, operator)
+
+		case code.OpAssignLocalCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			operator := code.Opcode(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			cell := vm.stack[frame.basePointer+localIndex].(*object.Cell)
+			result = vm.assign(&cell.Value, frame.cl.Fn.LocalNames, localIndex, operator)
+
+		case code.OpAssignFreeCell:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			operator := code.Opcode(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			currentClosure := vm.currentFrame().cl
+			cell := currentClosure.Free[freeIndex].(*object.Cell)
+			result = vm.assign(&cell.Value, currentClosure.Fn.FreeNames, freeIndex, operator)
+
+		case code.OpCurrentClosure:
+			result = vm.currentFrame().cl
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			result = vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			result = vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			result = evaluator.Interpolate(vm.stack[vm.sp-numParts : vm.sp])
+			vm.sp = vm.sp - numParts
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result = evaluator.EvalIndex(left, index)
+
+		case code.OpSetIndex:
+			operator := code.Opcode(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			if operator != 0 {
+				value = combine(operator, evaluator.EvalIndex(left, index), value)
+			}
+			result = value
+			if _, ok := value.(*object.Error); !ok {
+				result = evaluator.SetIndex(left, index, value)
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			var err error
+			result, err = vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			if vm.framesIndex == 1 {
+				vm.result = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			result = returnValue
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(nil)
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			var err error
+			result, err = vm.buildClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+
+		if result == nil {
+			continue
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			// runtime errors abort the program, as in the evaluator
+			vm.result = errObj
+			return nil
+		}
+		err := vm.push(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stores the value popped off the stack in the variable at slot, combined
+// with its current value by the infix operator if it is not 0, and returns
+// the stored value. Fails if the variable is unbound.
+func (vm *VM) assign(slot *object.Object, names []string, index int, operator code.Opcode) object.Object {
+	value := vm.pop()
+	if *slot == nil {
+		return &object.Error{Code: diagnostic.UNDECLARED_VARIABLE,
+			Message: "assignment to undeclared variable: " + variableName(names, index)}
+	}
+
+	if operator != 0 {
+		value = combine(operator, *slot, value)
+		if _, ok := value.(*object.Error); ok {
+			return value
+		}
+	}
+	*slot = value
+	return value
+}
+
+// Applies the infix operator of a compound assignment to the current value
+// and the assigned one
+func combine(operator code.Opcode, current, value object.Object) object.Object {
+	if _, ok := current.(*object.Error); ok {
+		return current
+	}
+	return evaluator.EvalInfix(infixOperators[operator], current, value)
+}
+
+// Pushes the next key and value of it for numVars loop variables, or jumps
+// to pos if it has none left
+func (vm *VM) iterNext(it *object.Iterator, numVars int, pos int) error {
+	key, value, ok := it.Next()
+	if !ok {
+		vm.currentFrame().ip = pos - 1
+		return nil
+	}
+
+	if numVars == 2 {
+		err := vm.push(key)
+		if err != nil {
+			return err
+		}
+		return vm.push(value)
+	}
+	if it.Keyed() {
+		return vm.push(key)
+	}
+	return vm.push(value)
+}
+
+func unboundError(names []string, index int) *object.Error {
+	return &object.Error{Message: "identifier not found: " + variableName(names, index)}
+}
+
+// Returns the name of the variable in slot index, or ? if it is unknown
+func variableName(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return "?"
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp += 1
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp -= 1
+	return o
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) object.Object {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return &object.Error{Message: fmt.Sprintf("unusable as hash key: %s", key.Type())}
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}
+}
+
+// Calls the function below the numArgs arguments on the stack. Closures get
+// a new frame and return nil; builtins are applied immediately and their
+// result is returned, as is the error for a wrong number of arguments.
+func (vm *VM) executeCall(numArgs int) (object.Object, error) {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return &object.Error{Code: diagnostic.WRONG_ARGUMENT_COUNT,
+				Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d",
+					callee.Fn.NumParameters, numArgs)}, nil
+		}
+		return nil, vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		args := vm.stack[vm.sp-numArgs : vm.sp]
+		result := callee.Call(nil, args...)
+		vm.sp = vm.sp - numArgs - 1
+		return result, nil
+	default:
+		return &object.Error{Message: fmt.Sprintf("not a function: %s", callee.Type())}, nil
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	vm.pushFrame(frame)
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	// clear slots left over from earlier calls so unbound locals are detected
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	// each call gets new cells, holding the arguments for parameters
+	for _, slot := range cl.Fn.Cells {
+		i := frame.basePointer + slot
+		vm.stack[i] = &object.Cell{Value: vm.stack[i]}
+	}
+
+	return nil
+}
+
+func (vm *VM) buildClosure(constIndex int, numFree int) (object.Object, error) {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return nil, fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	return &object.Closure{Fn: function, Free: free}, nil
+}
@@ -0,0 +1,933 @@
+package vm
+
+import (
+	"testing"
+
+	"interpreter/compiler"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+)
+
+func runVM(t *testing.T, input string) object.Object {
+	l := lexer.NewLexer([]byte(input))
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return vm.Result()
+}
+
+func runEvaluator(input string) object.Object {
+	l := lexer.NewLexer([]byte(input))
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	return evaluator.Eval(program, env)
+}
+
+// Checks that the VM and the tree walking evaluator agree on every input
+func testMatchesEvaluator(t *testing.T, inputs []string) {
+	for _, input := range inputs {
+		expected := runEvaluator(input)
+		actual := runVM(t, input)
+		testSameObject(t, input, expected, actual)
+	}
+}
+
+func testSameObject(t *testing.T, input string, expected, actual object.Object) {
+	switch expected := expected.(type) {
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("%q: object is not Error. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				input, expected.Message, errObj.Message)
+		}
+
+	case *object.Function:
+		closure, ok := actual.(*object.Closure)
+		if !ok {
+			t.Errorf("%q: object is not Closure. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if closure.Fn.NumParameters != len(expected.Parameters) {
+			t.Errorf("%q: wrong number of parameters. expected=%d, got=%d",
+				input, len(expected.Parameters), closure.Fn.NumParameters)
+		}
+
+	case *object.Array:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%q: object is not Array. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected.Elements) {
+			t.Errorf("%q: wrong number of elements. expected=%d, got=%d",
+				input, len(expected.Elements), len(array.Elements))
+			return
+		}
+		for i, el := range expected.Elements {
+			testSameObject(t, input, el, array.Elements[i])
+		}
+
+	case *object.Hash:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("%q: object is not Hash. got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if len(hash.Pairs) != len(expected.Pairs) {
+			t.Errorf("%q: wrong number of pairs. expected=%d, got=%d",
+				input, len(expected.Pairs), len(hash.Pairs))
+			return
+		}
+		for key, pair := range expected.Pairs {
+			actualPair, ok := hash.Pairs[key]
+			if !ok {
+				t.Errorf("%q: no pair for key %s", input, pair.Key.Inspect())
+				continue
+			}
+			testSameObject(t, input, pair.Value, actualPair.Value)
+		}
+
+	case nil:
+		if actual != nil {
+			t.Errorf("%q: expected no value. got=%T (%+v)", input, actual, actual)
+		}
+
+	default:
+		if actual == nil {
+			t.Errorf("%q: expected %s, got no value", input, expected.Inspect())
+			return
+		}
+		if actual.Type() != expected.Type() || actual.Inspect() != expected.Inspect() {
+			t.Errorf("%q: wrong object. expected=%s (%s), got=%s (%s)", input,
+				expected.Inspect(), expected.Type(), actual.Inspect(), actual.Type())
+		}
+		if expected == evaluator.NULL && actual != evaluator.NULL {
+			t.Errorf("%q: object is not NULL. got=%T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"5",
+		"10",
+		"-5",
+		"-10",
+		"0xFF + 0o10 + 0b11",
+		"1_000 * 1e3",
+		"5 + 5 + 5 + 5 - 10",
+		"2 * 2 * 2 * 2 * 2",
+		"-50 + 100 + -50",
+		"5 * 2 + 10",
+		"5 + 2 * 10",
+		"20 + 2 * -10",
+		"50 / 2 * 2 + 10",
+		"2 * (5 + 10)",
+		"3 * 3 * 3 + 10",
+		"3 * (3 * 3) + 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"7 % 3",
+		"-7 % 3",
+		"12 & 10 | 1 ^ 3",
+		"~5",
+		"1 << 10 >> 2",
+		"2 ** 3 ** 2",
+		"-2 ** 2",
+		"2 ** -1",
+		"2 ** 100",
+		"9223372036854775807 + 1",
+		"(4294967296 * 4294967296) / 4294967296",
+		"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)",
+		"{9223372036854775807 * 2: 1}[9223372036854775807 + 9223372036854775807]",
+	})
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"2.5",
+		"-2.5",
+		"1 + 0.5",
+		"10 / 4.0",
+		"1 < 1.5",
+		"1 == 1.0",
+		"round(2.5) + floor(1.5)",
+	})
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"true",
+		"false",
+		"1 < 2",
+		"1 > 2",
+		"1 < 1",
+		"1 > 1",
+		"1 == 1",
+		"1 != 1",
+		"1 == 2",
+		"1 != 2",
+		"true == true",
+		"false == false",
+		"true == false",
+		"true != false",
+		"false != true",
+		"(1 < 2) == true",
+		"(1 < 2) == false",
+		"(1 > 2) == true",
+		"(1 > 2) == false",
+		"!true",
+		"!false",
+		"!5",
+		"!!true",
+		"!!false",
+		"!!5",
+		"1 <= 2",
+		"2 >= 3",
+		`"a" == "a"`,
+		`"a" < "b"`,
+		"true && false",
+		"1 && 2",
+		"false || 0",
+		"false || true && false",
+		"false && undefinedName",
+		"true || 1 / 0",
+		"1 > 2 || 1 / 0",
+		"let f = fn(a, b) { a && b }; [f(true, 1), f(0, false), f(false, true)]",
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"if (true) { 10 }",
+		"if (false) { 10 }",
+		"if (1) { 10 }",
+		"if (1 < 2) { 10 }",
+		"if (1 > 2) { 10 }",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (1 < 2) { 10 } else { 20 }",
+		"if ((if (false) { 10 })) { 10 } else { 20 }",
+		"if (true) { let a = 1; }; 5",
+	})
+}
+
+func TestReturnStatements(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"return 10;",
+		"return 10; 9;",
+		"return 2 * 5; 9;",
+		"9; return 2 * 5; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+	})
+}
+
+func TestErrorHandling(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"5 + true;",
+		"5 + true; 5;",
+		"-true",
+		"true + false;",
+		"5; true + false; 5",
+		"if (10 > 1) { true + false; }",
+		`
+      if (10 > 1) {
+        if (10 > 1) {
+          return true + false;
+        }
+        return 1;
+      }
+      `,
+		"foobar",
+		`"Hello" - "World"`,
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		"5(1)",
+		"let f = fn() { if (false) { let x = 1; }; x }; f()",
+		"10 / 0",
+		"1.5 / 0.0",
+		`[1, 2, 3]["1"]`,
+		"(9223372036854775807 + 1) / 0",
+		"1 / 0.0",
+		"let x = 0; 10 % x",
+		"0 ** -1",
+		"1 << -1",
+		"1 << 10000000",
+		"10 ** 10000000",
+		"1 << 9223372036854775807",
+		"1024 ** 4611686018427387904",
+		"(-3) ** 9223372036854775807",
+		"1.5 & 1",
+		"~1.5",
+		"true | false",
+		"let add = fn(a, b) { a + b }; add(1)",
+		"fn() { 1 }(1, 2)",
+		"[1, 2, 3][1.0]",
+	})
+}
+
+func TestLetStatements(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let a = 5; a;",
+		"let a = 5 * 5; a;",
+		"let a = 5; let b = a; b;",
+		"let a = 5; let b = a; let c = a + b + 5; c;",
+		"let a = 1; let a = a + 1; a",
+		"let x = 1;",
+		"1; let x = 2",
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"fn(x) { x + 2; };",
+		"let identity = fn(x) { x; }; identity(5);",
+		"let identity = fn(x) { return x; }; identity(5);",
+		"let double = fn(x) { x * 2; }; double(5);",
+		"let add = fn(x, y) { x + y; }; add(5, 5);",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"fn(x) { x; }(5)",
+		"let early = fn() { return 1; 2 }; early();",
+		"let f = fn() { let g = fn() { h() }; g() }; let h = fn() { 3 }; f()",
+	})
+}
+
+func TestClosures(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3);",
+		`let newAdder = fn(a, b) {
+      let c = a + b;
+      fn(d) { let e = d + c; fn(f) { e + f; }; };
+    };
+    let adder = newAdder(1, 2);
+    let adderTwo = adder(3);
+    adderTwo(8);`,
+		`let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+    countDown(10);`,
+		`let wrapper = fn() {
+      let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+      countDown(1);
+    };
+    wrapper();`,
+		`let fibonacci = fn(x) {
+      if (x == 0) { return 0; }
+      if (x == 1) { return 1; }
+      fibonacci(x - 1) + fibonacci(x - 2);
+    };
+    fibonacci(15);`,
+	})
+}
+
+func TestStrings(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`"Hello World!"`,
+		`"Hello" + " " + "World!"`,
+		`let name = "Monkey"; let age = 9; "Hello ${name}, you are ${age + 1}"`,
+		`let h = {"key": [1, "two"]}; "${h["key"]} and ${"${1 + 1}"}"`,
+		`"value: ${missing}"`,
+	})
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`len("")`,
+		`len("four")`,
+		`len("hello world")`,
+		`len("日本語")`,
+		`bytelen("日本語")`,
+		`bytes("aé")`,
+		`"héllo"[1]`,
+		`"héllo"[5]`,
+		`slice("größer", 1, 4)`,
+		`slice([1, 2, 3], 1)`,
+		`slice("abc", 2, 1)`,
+		`len(1)`,
+		`len("one", "two")`,
+		`len([1, 2, 3])`,
+		`first([1, 2, 3])`,
+		`last([1, 2, 3])`,
+		`tail([1, 2, 3])`,
+		`let len = fn(x) { 42 }; len("a")`,
+		`len(push([], 1))`,
+		`push([1, 2], 3)[0]`,
+		`push([1, 2], 3)[2]`,
+		`let a = [1]; push(a, 2); len(a)`,
+	})
+}
+
+func TestArrays(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"[1, 2 * 2, 3 + 3]",
+		"[1, 2, 3][0]",
+		"[1, 2, 3][1]",
+		"[1, 2, 3][2]",
+		"let i = 0; [1][i];",
+		"[1, 2, 3][1 + 1];",
+		"let myArray = [1, 2, 3]; myArray[2];",
+		"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+		"[1, 2, 3][3]",
+		"[1, 2, 3][-1]",
+	})
+}
+
+func TestHashes(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`let two = "two";
+{
+"one": 10 - 9,
+two: 1 + 1,
+"thr" + "ee": 6 / 2,
+4: 4,
+true: 5,
+false: 6
+}`,
+		`{"foo": 5}["foo"]`,
+		`{"foo": 5}["bar"]`,
+		`let key = "foo"; {"foo": 5}[key]`,
+		`{}["foo"]`,
+		`{5: 5}[5]`,
+		`{true: 5}[true]`,
+		`{false: 5}[false]`,
+		`{[1]: 2}`,
+	})
+}
+
+func TestLoops(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let i = 0; while (i < 10) { let i = i + 1; }; i",
+		"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } }; i",
+		"let i = 0; let odd = 0; while (i < 10) { let i = i + 1; if (i % 2 == 0) { continue; } let odd = odd + i; }; odd",
+		"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s",
+		"let s = 0; for (i, x in [10, 20, 30]) { let s = s + i * x; }; s",
+		`let s = ""; for (k in {"b": 1, "a": 2}) { let s = s + k; }; s`,
+		`let s = 0; for (k, v in {"b": 1, "a": 2}) { let s = s * 10 + v; }; s`,
+		`let s = ""; for (c in "héllo") { if (c == "l") { continue; } let s = s + c; }; s`,
+		"let s = 0; for (x in range(1, 100)) { if (x > 4) { break; } let s = s + x; }; s",
+		"let s = 0; for (x in range(3)) { for (y in [10, 20, 30]) { if (y == 20) { break; } let s = s + x + y; } }; s",
+		"let f = fn(xs) { let s = 0; for (x in xs) { if (x < 0) { return x; } let s = s + x; }; s }; [f([1, 2]), f([1, -2, 3])]",
+		"let f = fn(n) { let i = 0; while (true) { let i = i + 1; if (i == n) { return i * 2; } } }; f(4)",
+		"let a = fn() { 0 }; let b = a; for (x in [1, 2]) { let b = a; let a = fn() { x }; }; a() * 10 + b()",
+		"for (x in 5) { x }",
+		"while (1 + true) { 1 }",
+	})
+
+	// breaking out of a loop more often than the stack has slots must not
+	// leave anything behind on it
+	testMatchesEvaluator(t, []string{
+		"let s = 0; for (x in range(5000)) { for (y in [1]) { break; } let s = s + 1; }; s",
+	})
+}
+
+func TestAssignments(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let x = 1; x = 2; x",
+		"let x = 1; let y = x = 5; [x, y]",
+		"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x",
+		`let s = "a"; s += "b"; s`,
+		"let f = fn(a) { a += 1; let b = a; b *= 2; b }; f(3)",
+		"let mk = fn() { let c = 0; fn() { c += 1 } }; let f = mk(); f(); f()",
+		"let f = fn() { let x = 0; let g = fn() { x = x + 1 }; g(); x }; f()",
+		"let f = fn() { let x = 0; let g = fn() { x }; x = 5; g() }; f()",
+		"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()",
+		"let f = fn(n) { let g = fn() { n *= 2 }; g(); g(); n }; f(3)",
+		"let f = fn() { let x = 1; let g = fn() { fn() { x += 10 } }; g()(); g()(); x }; f()",
+		"let mk = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let c = mk(); c[0](); c[0](); c[1]()",
+		"let mk = fn() { let n = 0; fn() { n += 1 } }; let a = mk(); let b = mk(); a(); a(); b()",
+		"let f = fn() { let fs = []; for (i in [1, 2]) { let fs = fs + [fn() { i }]; }; fs[0]() }; f()",
+		"let f = fn() { let g = fn() { x = 1 }; g() }; f()",
+		"let f = fn() { let g = fn() { y }; g() }; f()",
+		"let i = 0; let s = 0; while (i < 5) { i += 1; s += i; }; s",
+		"let a = [1, 2, 3]; a[1] = 5; a",
+		"let a = [1, 2, 3]; a[2] += 10; a[0] -= 1; a",
+		`let h = {"a": 1}; h["b"] = 2; h["a"] *= 5; [h["a"], h["b"]]`,
+		"let m = [[1], [2]]; m[1][0] += 40; m",
+		"let a = [1]; a[0] = 2",
+		"y = 5",
+		"y += 5",
+		"let f = fn() { z = 1 }; f()",
+		"let x = 10; x %= 0",
+		`let x = 1; x += "a"`,
+		"let a = [1]; a[5] = 2",
+		"let a = [1]; a[5] += 2",
+		`let a = [1]; a["x"] = 2`,
+	})
+}
+
+func TestWrongNumberOfArguments(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"fn(a, b) { a + b }(1);",
+		"fn() { 1 }(1, 2);",
+		"let f = fn(a) { a }; let g = fn() { f() }; g()",
+	})
+
+	result := runVM(t, "fn(a, b) { a + b }(1);")
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", result, result)
+	}
+	if errObj.Code != diagnostic.WRONG_ARGUMENT_COUNT {
+		t.Errorf("wrong error code. want=%s, got=%s", diagnostic.WRONG_ARGUMENT_COUNT, errObj.Code)
+	}
+}
+
+func TestEvalIntegerExpression(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"5",
+		"10",
+		"-5",
+		"-10",
+		"0xFF + 0o10 + 0b11",
+		"1_000_000 / 1_000",
+		"5 + 5 + 5 + 5 - 10",
+		"2 * 2 * 2 * 2 * 2",
+		"-50 + 100 + -50",
+		"5 * 2 + 10",
+		"5 + 2 * 10",
+		"20 + 2 * -10",
+		"50 / 2 * 2 + 10",
+		"2 * (5 + 10)",
+		"3 * 3 * 3 + 10",
+		"3 * (3 * 3) + 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"7 % 3",
+		"-7 % 3",
+		"2 + 7 % 4 * 2",
+		"12 & 10",
+		"12 | 10",
+		"12 ^ 10",
+		"~5",
+		"~-1",
+		"1 << 10",
+		"1024 >> 3",
+		"-16 >> 2",
+		"-1 >> 100",
+		"5 >> 100",
+		"1 << 2 + 1",
+		"2 ** 10",
+		"2 ** 3 ** 2",
+		"-2 ** 2",
+		"(-2) ** 3",
+		"10 ** 0",
+		"(1 << 62) >> 60",
+	})
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"true",
+		"false",
+		"1 < 2",
+		"1 > 2",
+		"1 < 1",
+		"1 > 1",
+		"1 == 1",
+		"1 != 1",
+		"1 == 2",
+		"1 != 2",
+		"true == true",
+		"false == false",
+		"true == false",
+		"true != false",
+		"false != true",
+		"(1 < 2) == true",
+		"(1 < 2) == false",
+		"(1 > 2) == true",
+		"(1 > 2) == false",
+		"1 <= 2",
+		"2 <= 2",
+		"3 <= 2",
+		"1 >= 2",
+		"2 >= 2",
+		"2.5 >= 2",
+		"1.5 <= 1",
+		`"a" == "a"`,
+		`"a" != "a"`,
+		`"a" < "b"`,
+		`"abc" > "abd"`,
+		`"b" >= "abc"`,
+		`"" <= ""`,
+	})
+}
+
+func TestBangOperator(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"!true",
+		"!false",
+		"!5",
+		"!!true",
+		"!!false",
+		"!!5",
+	})
+}
+
+func TestLogicalOperators(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"true && true",
+		"true && false",
+		"false && true",
+		"false || true",
+		"false || false",
+		"1 && \"a\"",
+		"1 < 2 && 2 < 3",
+		"1 > 2 || 2 > 3",
+		"false || true && false",
+		"let x = 0; false && (x = 1); x == 0",
+		"let x = 0; true || (x = 1); x == 0",
+		"let x = 0; true && (x = 1); x == 1",
+		"false && undefinedName",
+		"true || 1 / 0",
+	})
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"if (true) { 10 }",
+		"if (false) { 10 }",
+		"if (1) { 10 }",
+		"if (1 < 2) { 10 }",
+		"if (1 > 2) { 10 }",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (1 < 2) { 10 } else { 20 }",
+		"if (true) { let x = 1 }",
+		"if (true) { }",
+		"if (false) { 1 } else { let y = 2 }",
+	})
+}
+
+func TestErrorPositions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"foobar",
+		"let a = 5;\nlet b = a + true;",
+		"let f = fn(x) {\n  x - \"a\"\n};\nf(1);",
+		"len(1, 2)",
+	})
+}
+
+func TestFunctionObject(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"fn(x) { x + 2; };",
+	})
+}
+
+func TestFunctionApplication(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let identity = fn(x) { x; }; identity(5);",
+		"let identity = fn(x) { return x; }; identity(5);",
+		"let double = fn(x) { x * 2; }; double(5);",
+		"let add = fn(x, y) { x + y; }; add(5, 5);",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"fn(x) { x; }(5)",
+		"let f = fn() { let x = 1 }; f()",
+		"let f = fn() { }; f()",
+		"let f = fn() { 5; while (false) {} }; f()",
+	})
+}
+
+func TestStringLiteral(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`"Hello World!"`,
+	})
+}
+
+func TestStringEscapes(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`"tab\there"`,
+		`"quote: \"" + "\u{263A}"`,
+		"`raw ${x} \\n`",
+		"`two\nlines`",
+	})
+}
+
+func TestStringInterpolation(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`let name = "Monkey"; let age = 9; "Hello ${name}, you are ${age + 1}"`,
+		`"${1}${2}"`,
+		`"${[1, "two", 3.5]} ${true} ${if (false) { 1 }}"`,
+		`let h = {"key": "value"}; "got ${h["key"]}"`,
+		`"outer ${"inner ${1 + 1}"}"`,
+		`"${fn(x) { let y = {"a": x}; y["a"] }(4)}"`,
+		`"cost: \${price}"`,
+		`"just $ and {braces}"`,
+		`"value: ${missing}"`,
+	})
+}
+
+func TestStringConcatenation(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`"Hello" + " " + "World!"`,
+	})
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`len("héllo")`,
+		`len("日本語")`,
+		`bytelen("日本語")`,
+		`bytes("aé")`,
+		`"日本語"[1]`,
+		`"héllo"[4]`,
+		`"héllo"[5]`,
+		`"héllo"[-1]`,
+		`"abc"[9223372036854775807 + 1]`,
+		`"abc"["0"]`,
+		`slice("größer", 1, 4)`,
+		`slice("größer", 3)`,
+		`slice("abc", 3)`,
+		`slice([1, 2, 3, 4], 1, 3)`,
+		`slice("abc", 2, 1)`,
+		`slice("日本", 0, 3)`,
+		`slice("abc", "1")`,
+		`slice(1, 0)`,
+		`bytes(1)`,
+		`let s = ""; for (c in "añb") { let s = c + s; }; s`,
+		`let größe = 3; let _x1 = größe * 2; _x1`,
+	})
+}
+
+func TestArrayLiterals(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"[1, 2 * 2, 3 + 3]",
+	})
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"[1, 2, 3][0]",
+		"[1, 2, 3][1]",
+		"[1, 2, 3][2]",
+		"let i = 0; [1][i];",
+		"[1, 2, 3][1 + 1];",
+		"let myArray = [1, 2, 3]; myArray[2];",
+		"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+		"[1, 2, 3][3]",
+		"[1, 2, 3][-1]",
+	})
+}
+
+func TestHashLiterals(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`let two = "two";
+{
+"one": 10 - 9,
+two: 1 + 1,
+"thr" + "ee": 6 / 2,
+4: 4,
+true: 5,
+false: 6
+}`,
+	})
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		`{"foo": 5}["foo"]`,
+		`{"foo": 5}["bar"]`,
+		`let key = "foo"; {"foo": 5}[key]`,
+		`{}["foo"]`,
+		`{5: 5}[5]`,
+		`{true: 5}[true]`,
+		`{false: 5}[false]`,
+		`{1: 5}[1.0]`,
+		`{2.0: 5}[2]`,
+		`{1: 5}[1.5]`,
+	})
+}
+
+func TestWhileStatements(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let i = 0; let f = fn(x) { x + 1 }; while (false) { 1 }; 5",
+		"let count = fn(n) { let i = 0; let acc = 0; while (i < n) { let acc = acc + i; let i = i + 1; }; acc }; count(5)",
+		"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i; } } }; f()",
+		"let i = 0; while (true) { let i = i + 1; if (i > 4) { break; } }; i",
+		"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + 1; }; n",
+		"let i = 0; while (i < 3) { i += 1 }",
+		"let i = 0; while (i < 3) { i += 1; if (i == 2) { let z = 1 } }",
+		"5; while (false) {}",
+	})
+}
+
+func TestForStatements(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum",
+		"let sum = 0; for (i, x in [10, 20, 30]) { let sum = sum + i; }; sum",
+		"let sum = 0; for (x in range(5)) { let sum = sum + x; }; sum",
+		"let sum = 0; for (x in range(2, 10, 3)) { let sum = sum + x; }; sum",
+		"let sum = 0; for (x in range(3, 0, -1)) { let sum = sum + x; }; sum",
+		`let s = ""; for (c in "abc") { let s = c + s; }; s`,
+		`let s = ""; for (k in {"b": 2, "a": 1}) { let s = s + k; }; s`,
+		`let sum = 0; for (k, v in {"a": 1, "b": 2}) { let sum = sum + v; }; sum`,
+		"let last = 0; for (x in range(100)) { if (x == 7) { break; } let last = x; }; last",
+		"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } let sum = sum + x; }; sum",
+		"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()",
+		"for (x in 5) { x }",
+		"for (x in [1]) { x + true }",
+		"range(1, 2, 0)",
+		"len(range(0, 10, 3))",
+		"len(range(-9223372036854775807, 9223372036854775807, 2))",
+		"len(range(9223372036854775807, -9223372036854775807, -9223372036854775807))",
+		"let last = 0; for (x in range(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807)) { let last = x; }; last",
+		"for (x in [1]) { x }",
+		"5; for (x in []) {}",
+	})
+}
+
+func TestAssignExpressions(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let x = 1; x = 5; x",
+		"let x = 1; x = 5",
+		"let x = 1; let y = 2; x = y = 7; x + y",
+		"let x = 10; x += 5; x",
+		"let x = 10; x -= 5; x",
+		"let x = 10; x *= 5; x",
+		"let x = 10; x /= 5; x",
+		"let x = 10; x %= 4; x",
+		`let s = "a"; s += "b"; s`,
+		"let x = 1; let f = fn() { x = 2 }; f(); x",
+		"let x = 1; let f = fn() { let x = 5; x = 2 }; f(); x",
+		"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",
+		"let i = 0; while (i < 5) { i += 1; }; i",
+		"let a = [1, 2, 3]; a[0] = 10; a[0] + a[1]",
+		"let a = [1, 2, 3]; a[2] *= 3; a[2]",
+		`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`,
+		`let h = {"a": 1}; h["a"] += 41; h["a"]`,
+		"let m = [[1, 2], [3, 4]]; m[1][0] = 7; m[1][0]",
+		"y = 5",
+		"y += 5",
+		"let a = [1]; a[3] = 1",
+		`let a = [1]; a["x"] = 1`,
+		"let h = {}; h[fn() {}] = 1",
+		"let x = 1; x = x + true",
+		"let x = 10; x %= 0",
+		`let s = "abc"; s[0] = "x"`,
+	})
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"2.5",
+		"-2.5",
+		"1.5e-3 * 2",
+		"1e3 + 0.5",
+		"1.5 + 1.5",
+		"1 + 0.5",
+		"0.5 + 1",
+		"10 / 4.0",
+		"3 * 1.5 - 0.5",
+		"let x = 1; x += 0.25; x",
+		"(1 + 2 + 3) / 3.0",
+		"7.5 % 2",
+		"2 ** -1",
+		"4 ** 0.5",
+		"2.0 ** 3",
+		"1.5 < 2",
+		"2 > 2.5",
+		"1 == 1.0",
+		"1.0 != 1",
+		"0.1 + 0.2 == 0.3",
+	})
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"int(3.9)",
+		"int(-3.9)",
+		`int("42")`,
+		"int(true)",
+		"float(3)",
+		`float("2.5")`,
+		"round(2.5)",
+		"round(-2.4)",
+		"round(3.14159, 2)",
+		"floor(2.7)",
+		"floor(-2.2)",
+		"ceil(2.2)",
+		"ceil(5)",
+		`int("abc")`,
+		`int(float("NaN"))`,
+		"floor([])",
+		"float(1, 2)",
+	})
+}
+
+func TestIntegerOverflowPromotion(t *testing.T) {
+	factorial := "let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; "
+	testMatchesEvaluator(t, []string{
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 2",
+		"4294967296 * 4294967296",
+		"(9223372036854775807 + 1) - 1",
+		"(4294967296 * 4294967296) / 4294967296",
+		"let min = -9223372036854775807 - 1; -min",
+		"let min = -9223372036854775807 - 1; min / -1",
+		"let min = -9223372036854775807 - 1; min * -1",
+		"let min = -9223372036854775807 - 1; -1 * min",
+		factorial + "fact(25)",
+		factorial + "fact(25) / fact(23)",
+		factorial + "-fact(21)",
+		"let x = 9223372036854775807; x += 10; x",
+		`int("123456789012345678901234567890")`,
+		"int(100000000000000000000.0)",
+		"round(4294967296 * 4294967296)",
+		"2 ** 100",
+		"1 << 64",
+		"(1 << 64) >> 60",
+		"(1 << 64) | 1",
+		"((1 << 64) + 5) & 7",
+		"~(1 << 64)",
+		"(2 ** 70) % 1000",
+		"1 ** 100000000000",
+		"(-1) ** 100000000001",
+	})
+}
+
+func TestBigIntegerComparisonAndHashing(t *testing.T) {
+	big := "let big = 9223372036854775807 * 4; "
+	testMatchesEvaluator(t, []string{
+		big + "big > 9223372036854775807",
+		big + "big < 1",
+		big + "big == 9223372036854775807 * 4",
+		big + "big != big + 1",
+		big + "big == 9223372036854775807",
+		big + "big > 1.5",
+		big + "let h = {}; h[big] = 1; h[9223372036854775807 * 2 * 2]",
+		big + "let h = {big: 1, 5: 2}; h[big - big + 5]",
+		big + "[1, 2, 3][big]",
+		big + "let a = [1]; a[big] = 2",
+	})
+}
+
+// The VM does not enforce the limits of a host, so only the programs that end
+// within them are compared
+func TestEvaluationLimits(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let x = 0; while (x < 10) { x += 1 }; x",
+	})
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	testMatchesEvaluator(t, []string{
+		"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(49)",
+	})
+}